@@ -0,0 +1,218 @@
+package simhashing
+
+import "errors"
+import "fmt"
+import "sort"
+import "sync"
+
+// A fingerprint pipeline: how text is cut into tokens, how each token is hashed, how much each
+// token's vote counts and how wide the result is. The ID names all of that, and never changes
+// meaning: if any part of a pipeline changes (even fixing a bug) it gets a new ID, so a
+// fingerprint stored under an ID can always be compared with one computed today under that ID.
+type Algorithm struct {
+	ID        string
+	Tokenizer string // name from Tokenizers()
+	TokenHash string // name from TokenHashes(), or "buzhash" or "rabinkarp" for the rolling tokenizers
+	Weighting string // "uniform": every token votes once, "weighted": as often as the tokenizer says
+	Width     uint8  // bits in the fingerprint, 64 for now
+	Window    int    // tokens in a shingle, only for the rolling tokenizers ("bytes" and "words")
+
+	counts func(text string) [64]int
+}
+
+// What SimHash does, and what a SimStore uses unless told otherwise
+const DefaultAlgorithm = "simhash64-shingle3-strong64-uniform-v1"
+
+// Returned when a snapshot or caller names an algorithm we don't have
+var ErrUnknownAlgorithm = errors.New("simhashing: unknown algorithm")
+
+// splits text into the tokens that get to vote, and says how many votes each one gets
+type tokenizer func(text string, emit func(token string, weight int))
+
+var tokenizers = map[string]tokenizer{
+	"shingle3": func(text string, emit func(string, int)) {
+		for _, token := range Tokenize_stride(text, shingle_length) {
+			emit(token, 1)
+		}
+	},
+}
+
+var weightings = map[string]bool{"uniform": true, "weighted": true}
+
+// Returns the names of the tokenizers an Algorithm can use, sorted
+func Tokenizers() []string {
+
+	names := make([]string, 0, len(tokenizers)+len(rolling_tokenizers))
+	for name := range tokenizers {
+		names = append(names, name)
+	}
+	for name := range rolling_tokenizers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+var (
+	algorithms_mu sync.RWMutex
+	algorithms    = make(map[string]*Algorithm)
+)
+
+func init() {
+	for _, a := range []Algorithm{
+		{ID: DefaultAlgorithm, Tokenizer: "shingle3", TokenHash: "strong64", Weighting: "uniform", Width: 64},
+		{ID: "simhash64-shingle3-xxh64-uniform-v1", Tokenizer: "shingle3", TokenHash: "xxh64", Weighting: "uniform", Width: 64},
+		{ID: "simhash64-shingle3-fnv1a64-uniform-v1", Tokenizer: "shingle3", TokenHash: "fnv1a64", Weighting: "uniform", Width: 64},
+	} {
+		if err := RegisterAlgorithm(a); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Registers a pipeline under a.ID. All of its parts have to exist already, so to use a keyed
+// SipHash register that as a token hash first. IDs can't be registered twice.
+//
+// The rolling tokenizers hash every shingle of Window bytes or words in constant time, with
+// "buzhash" or "rabinkarp" as the TokenHash, for example:
+//
+//	Algorithm{ID: "simhash64-words5-buzhash-uniform-v1", Tokenizer: "words", TokenHash: "buzhash", Window: 5, Weighting: "uniform", Width: 64}
+func RegisterAlgorithm(a Algorithm) error {
+
+	if !weightings[a.Weighting] {
+		return fmt.Errorf("simhashing: algorithm %q: unknown weighting %q", a.ID, a.Weighting)
+	}
+	if a.Width != 64 {
+		return fmt.Errorf("simhashing: algorithm %q: only 64 bit fingerprints are supported", a.ID)
+	}
+
+	var err error
+	if _, rolling := rolling_tokenizers[a.Tokenizer]; rolling {
+		a.counts, err = rolling_counts(a)
+	} else {
+		a.counts, err = token_pipeline(a)
+	}
+	if err != nil {
+		return err
+	}
+
+	algorithms_mu.Lock()
+	defer algorithms_mu.Unlock()
+
+	if _, exists := algorithms[a.ID]; exists {
+		return fmt.Errorf("simhashing: algorithm %q is already registered", a.ID)
+	}
+	algorithms[a.ID] = &a
+
+	return nil
+}
+
+// tokenizer -> token hash -> votes
+func token_pipeline(a Algorithm) (func(string) [64]int, error) {
+
+	tokenize, ok := tokenizers[a.Tokenizer]
+	if !ok {
+		return nil, fmt.Errorf("simhashing: algorithm %q: unknown tokenizer %q", a.ID, a.Tokenizer)
+	}
+	h, ok := LookupTokenHash(a.TokenHash)
+	if !ok {
+		return nil, fmt.Errorf("simhashing: algorithm %q: unknown token hash %q", a.ID, a.TokenHash)
+	}
+	if a.Window != 0 {
+		return nil, fmt.Errorf("simhashing: algorithm %q: tokenizer %q has no window", a.ID, a.Tokenizer)
+	}
+
+	uniform := a.Weighting == "uniform"
+	return func(text string) (counts [64]int) {
+		tokenize(text, func(token string, weight int) {
+			if uniform {
+				weight = 1
+			}
+			add_weighted_votes(&counts, h(token), weight)
+		})
+		return
+	}, nil
+}
+
+// Returns the algorithm registered under id
+func LookupAlgorithm(id string) (Algorithm, bool) {
+
+	a := lookup_algorithm(id)
+	if a == nil {
+		return Algorithm{}, false
+	}
+	return *a, true
+}
+
+func lookup_algorithm(id string) *Algorithm {
+
+	algorithms_mu.RLock()
+	defer algorithms_mu.RUnlock()
+
+	return algorithms[id]
+}
+
+// Returns all registered algorithms, sorted by ID
+func Algorithms() []Algorithm {
+
+	algorithms_mu.RLock()
+	defer algorithms_mu.RUnlock()
+
+	all := make([]Algorithm, 0, len(algorithms))
+	for _, a := range algorithms {
+		all = append(all, *a)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].ID < all[j].ID })
+
+	return all
+}
+
+// Returns the fingerprint of text under this algorithm
+func (a Algorithm) Hash(text string) uint64 {
+
+	counts := a.counts(text)
+	return simhash_from_counts(&counts)
+}
+
+// Creates a new SimStore that fingerprints text with the algorithm registered under id
+func NewSimStoreWithAlgorithm(id string) (*SimStore, error) {
+
+	a := lookup_algorithm(id)
+	if a == nil {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownAlgorithm, id)
+	}
+
+	s := NewSimStore()
+	if id != DefaultAlgorithm { // SimHash is a bit quicker than going through the registry
+		s.algorithm = a
+	}
+	return s, nil
+}
+
+// Returns the algorithm this store fingerprints text with
+func (s *SimStore) Algorithm() Algorithm {
+
+	if s.algorithm == nil {
+		return *lookup_algorithm(DefaultAlgorithm)
+	}
+	return *s.algorithm
+}
+
+// the fingerprint of text in this store
+func (s *SimStore) hash(text string) uint64 {
+
+	if s.algorithm == nil {
+		return SimHash(text)
+	}
+	return s.algorithm.Hash(text)
+}
+
+// same as SimHashWithMargins, for this store's algorithm
+func (s *SimStore) hash_with_margins(text string) (uint64, [64]int) {
+
+	if s.algorithm == nil {
+		return SimHashWithMargins(text)
+	}
+	return margins_from_counts(s.algorithm.counts(text))
+}
@@ -0,0 +1,141 @@
+package simhashing
+
+import "testing"
+import "bytes"
+import "encoding/binary"
+import "errors"
+
+// If any of these change, every fingerprint anyone stored under these IDs is wrong:
+// don't update the numbers, make a new algorithm ID instead.
+var golden = []struct {
+	text                     string
+	strong64, xxh64, fnv1a64 uint64
+}{
+	{"", 0xbb40e64da205b064, 0xef46db3751d8e999, 0xcbf29ce484222325},
+	{"a", 0xa6a08c821b91fd10, 0xd24ec4f1a98c6e5b, 0xaf63dc4c8601ec8c},
+	{"abc", 0xabf91024e70a2899, 0x44bc2cf5ad770999, 0xe71fa2190541574b},
+	{"hello world", 0x64b55118a69c3d71, 0xce7cfdad6603a122, 0x125ab51929a9e33c},
+	{"It was the best of times, it was the worst of times,", 0xc0475c99ffba18da, 0x291b720a8b18c526, 0xc29181194dd3ec3a},
+	{"The quick brown fox jumps over the lazy dog", 0xa12fdd9bf4bc4ce0, 0x4152aa301959af8e, 0xc2d1ac196ddbe00e},
+	{"Ünïcödé tëxt ✓", 0x41e50e82f82edefd, 0x364afa8ee98b3454, 0x57c299180f627008},
+}
+
+func TestGoldenVectors(t *testing.T) {
+
+	ids := []string{DefaultAlgorithm, "simhash64-shingle3-xxh64-uniform-v1", "simhash64-shingle3-fnv1a64-uniform-v1"}
+	var algorithms []Algorithm
+	for _, id := range ids {
+		a, ok := LookupAlgorithm(id)
+		if !ok {
+			t.Fatalf("%s isn't registered", id)
+		}
+		algorithms = append(algorithms, a)
+	}
+
+	for _, g := range golden {
+		if got := SimHash(g.text); got != g.strong64 {
+			t.Errorf("SimHash(%q) = 0x%016x, expected 0x%016x", g.text, got, g.strong64)
+		}
+		for i, expected := range []uint64{g.strong64, g.xxh64, g.fnv1a64} {
+			if got := algorithms[i].Hash(g.text); got != expected {
+				t.Errorf("%s(%q) = 0x%016x, expected 0x%016x", ids[i], g.text, got, expected)
+			}
+		}
+	}
+}
+
+func TestAlgorithmRegistry(t *testing.T) {
+
+	all := Algorithms()
+	for i := 1; i < len(all); i++ {
+		if all[i-1].ID >= all[i].ID {
+			t.Errorf("Algorithms aren't sorted: %s, %s", all[i-1].ID, all[i].ID)
+		}
+	}
+
+	if err := RegisterAlgorithm(Algorithm{ID: DefaultAlgorithm, Tokenizer: "shingle3", TokenHash: "strong64", Weighting: "uniform", Width: 64}); err == nil {
+		t.Error("Registering an ID twice should fail")
+	}
+	for _, a := range []Algorithm{
+		{ID: "bad-tokenizer", Tokenizer: "words", TokenHash: "strong64", Weighting: "uniform", Width: 64},
+		{ID: "bad-hash", Tokenizer: "shingle3", TokenHash: "md5", Weighting: "uniform", Width: 64},
+		{ID: "bad-weighting", Tokenizer: "shingle3", TokenHash: "strong64", Weighting: "tfidf", Width: 64},
+		{ID: "bad-width", Tokenizer: "shingle3", TokenHash: "strong64", Weighting: "uniform", Width: 128},
+	} {
+		if err := RegisterAlgorithm(a); err == nil {
+			t.Errorf("Registering %s should fail", a.ID)
+		}
+	}
+
+	if _, err := NewSimStoreWithAlgorithm("nope"); !errors.Is(err, ErrUnknownAlgorithm) {
+		t.Errorf("Expected ErrUnknownAlgorithm, got %v", err)
+	}
+	if NewSimStore().Algorithm().ID != DefaultAlgorithm {
+		t.Error("A new store should use the default algorithm")
+	}
+}
+
+func TestStoreAlgorithm(t *testing.T) {
+
+	const id = "simhash64-shingle3-xxh64-uniform-v1"
+	simstore, err := NewSimStoreWithAlgorithm(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := "It was the best of times, it was the worst of times,"
+	simstore.Insert(text, 1)
+	if found := simstore.exact(SimHashWith(text, XXH64), nil); len(found) != 1 {
+		t.Error("Insert didn't use the store's algorithm")
+	}
+	if found, _, _ := simstore.Find(text, 0); len(found) != 1 {
+		t.Errorf("Find didn't use the store's algorithm: %v", found)
+	}
+
+	// the algorithm survives a snapshot
+	var buf bytes.Buffer
+	if _, err := simstore.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ReadSimStore(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Algorithm().ID != id {
+		t.Errorf("Loaded store uses %s", loaded.Algorithm().ID)
+	}
+	if found, _, _ := loaded.Find(text, 0); len(found) != 1 {
+		t.Errorf("Find on the loaded store: %v", found)
+	}
+}
+
+func TestSnapshotAlgorithm(t *testing.T) {
+
+	// a version 1 snapshot has no algorithm, its keys are DefaultAlgorithm ones
+	var v1 bytes.Buffer
+	v1.WriteString(snapshot_magic)
+	binary.Write(&v1, binary.LittleEndian, uint32(1))
+	binary.Write(&v1, binary.LittleEndian, uint64(1))
+	binary.Write(&v1, binary.LittleEndian, SimHash("hello"))
+	binary.Write(&v1, binary.LittleEndian, int64(7))
+
+	loaded, err := ReadSimStore(&v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if present, id := loaded.Contains("hello"); !present || id != 7 || loaded.Algorithm().ID != DefaultAlgorithm {
+		t.Errorf("Loading a version 1 snapshot: %v %d %s", present, id, loaded.Algorithm().ID)
+	}
+
+	// an algorithm we don't know
+	var unknown bytes.Buffer
+	unknown.WriteString(snapshot_magic)
+	binary.Write(&unknown, binary.LittleEndian, uint32(snapshot_version))
+	binary.Write(&unknown, binary.LittleEndian, uint64(0))
+	unknown.WriteByte(4)
+	unknown.WriteString("nope")
+
+	if _, err := ReadSimStore(&unknown); !errors.Is(err, ErrUnknownAlgorithm) {
+		t.Errorf("Expected ErrUnknownAlgorithm, got %v", err)
+	}
+}
@@ -0,0 +1,265 @@
+package simhashing
+
+import "math/bits"
+import "sort"
+
+// Content-defined chunking: one simhash for a long document can't say *which* part of it
+// is a near-duplicate of something. So we cut documents into chunks and simhash every chunk.
+// The cuts go where the content says (FastCDC: a gear hash over the last 64 bytes hits a
+// mask), not at fixed offsets, so an edit only changes the chunks around it and everything
+// after an insert still gets cut in the same places.
+
+// How big chunks get. Zero fields get the DefaultChunkOptions ones.
+type ChunkOptions struct {
+	MinSize int // no cuts before this many bytes
+	AvgSize int // aim for chunks about this size
+	MaxSize int // always cut after this many bytes
+}
+
+var DefaultChunkOptions = ChunkOptions{MinSize: 512, AvgSize: 2048, MaxSize: 8192}
+
+// A piece of a document
+type Chunk struct {
+	Offset int
+	Length int
+	Hash   uint64 // SimHash of the bytes in the chunk
+}
+
+// The simhashes of all chunks of a document, and a simhash for the whole thing
+type ChunkedHash struct {
+	Hash   uint64 // all chunks' votes added up: SimHash of the document, minus the shingles across cuts
+	Chunks []Chunk
+}
+
+// a random value for every byte for the gear hash, never change these or the cuts move
+var gear_table [256]uint64
+
+func init() {
+	x := uint64(0x6765617268617368) // "gearhash"
+	for i := range gear_table {
+		x, gear_table[i] = splitmix64(x)
+	}
+}
+
+// fills in the defaults and makes sure MinSize <= AvgSize <= MaxSize
+func (o ChunkOptions) normalized() ChunkOptions {
+
+	if o.MinSize < 1 {
+		o.MinSize = DefaultChunkOptions.MinSize
+	}
+	if o.AvgSize < 1 {
+		o.AvgSize = DefaultChunkOptions.AvgSize
+	}
+	if o.MaxSize < 1 {
+		o.MaxSize = DefaultChunkOptions.MaxSize
+	}
+	if o.AvgSize < o.MinSize {
+		o.AvgSize = o.MinSize
+	}
+	if o.MaxSize < o.AvgSize {
+		o.MaxSize = o.AvgSize
+	}
+
+	return o
+}
+
+// a mask with the top n bits set
+func top_bits(n int) uint64 {
+
+	if n <= 0 {
+		return 0
+	}
+	if n >= 64 {
+		return ^uint64(0)
+	}
+	return ^uint64(0) << uint(64-n)
+}
+
+// Returns where to cut src into chunks: the end offset of every chunk
+func ChunkBoundaries(src []byte, opts ChunkOptions) (ends []int) {
+
+	opts = opts.normalized()
+
+	// normalized chunking: a harder mask before AvgSize and an easier one after,
+	// so chunk sizes bunch up around AvgSize
+	avg_bits := bits.Len(uint(opts.AvgSize)) - 1
+	hard, easy := top_bits(avg_bits+1), top_bits(avg_bits-1)
+
+	for start := 0; start < len(src); {
+		start += next_cut(src[start:], opts, hard, easy)
+		ends = append(ends, start)
+	}
+
+	return
+}
+
+// how long the chunk at the start of src is
+func next_cut(src []byte, opts ChunkOptions, hard, easy uint64) int {
+
+	n := len(src)
+	if n <= opts.MinSize {
+		return n
+	}
+	if n > opts.MaxSize {
+		n = opts.MaxSize
+	}
+	normal := opts.AvgSize
+	if normal > n {
+		normal = n
+	}
+
+	var h uint64
+	i := opts.MinSize
+	for ; i < normal; i++ {
+		h = (h << 1) + gear_table[src[i]]
+		if h&hard == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		h = (h << 1) + gear_table[src[i]]
+		if h&easy == 0 {
+			return i + 1
+		}
+	}
+
+	return n
+}
+
+// Cuts src into content-defined chunks and simhashes every chunk and the whole document
+func SimHashChunks(src []byte, opts ChunkOptions) (ch ChunkedHash) {
+
+	var total [64]int
+	start := 0
+	for _, end := range ChunkBoundaries(src, opts) {
+		var c bit_counter
+		shingle_votes(src[start:end], &c)
+		ch.Chunks = append(ch.Chunks, Chunk{Offset: start, Length: end - start, Hash: c.simhash()})
+
+		counts := c.counts()
+		for i := range total {
+			total[i] += counts[i]
+		}
+		start = end
+	}
+	ch.Hash = simhash_from_counts(&total)
+
+	return
+}
+
+// A store of document chunks, to find documents that share sections with another one
+// even when the documents as a whole are nothing alike.
+type ChunkStore struct {
+	store   *SimStore
+	options ChunkOptions
+	hashes  []uint64               // every distinct chunk hash, by its id in store
+	refs    map[uint64][]chunk_ref // where every chunk hash was seen
+	docs    map[int64][]Chunk      // the chunks of every document
+}
+
+type chunk_ref struct {
+	doc   int64
+	chunk int // index into docs[doc]
+}
+
+// Two chunks that are near-duplicates
+type SectionMatch struct {
+	Query    Chunk // from the text we searched with
+	Match    Chunk // from the stored document
+	Distance uint8
+}
+
+// A stored document that shares sections with the one we searched with
+type SharedSections struct {
+	Id       int64
+	Shared   int // how many chunks of the query have a near-duplicate in this document
+	Sections []SectionMatch
+}
+
+// Creates a new ChunkStore that cuts documents with opts
+func NewChunkStore(opts ChunkOptions) *ChunkStore {
+	return &ChunkStore{
+		store:   NewSimStore(),
+		options: opts.normalized(),
+		refs:    make(map[uint64][]chunk_ref),
+		docs:    make(map[int64][]Chunk),
+	}
+}
+
+// Chunks and indexes a document. Like in a SimStore ids don't have to be unique, inserting
+// an id again adds more chunks to it.
+func (cs *ChunkStore) Insert(text string, id int64) {
+	cs.InsertBytes([]byte(text), id)
+}
+
+// Same as Insert
+func (cs *ChunkStore) InsertBytes(src []byte, id int64) {
+
+	chunks := SimHashChunks(src, cs.options).Chunks
+	first := len(cs.docs[id])
+	cs.docs[id] = append(cs.docs[id], chunks...)
+
+	for i, chunk := range chunks {
+		// boilerplate chunks show up in lots of documents, the trie only needs them once
+		if _, seen := cs.refs[chunk.Hash]; !seen {
+			cs.store.InsertHash(chunk.Hash, int64(len(cs.hashes)))
+			cs.hashes = append(cs.hashes, chunk.Hash)
+		}
+		cs.refs[chunk.Hash] = append(cs.refs[chunk.Hash], chunk_ref{doc: id, chunk: first + i})
+	}
+}
+
+// Returns the chunks of a stored document
+func (cs *ChunkStore) Chunks(id int64) []Chunk {
+	return cs.docs[id]
+}
+
+// Returns the documents that have a chunk within distance of a chunk of text, the ones that
+// share the most chunks first.
+func (cs *ChunkStore) FindShared(text string, distance uint8) []SharedSections {
+	return cs.FindSharedBytes([]byte(text), distance)
+}
+
+// Same as FindShared
+func (cs *ChunkStore) FindSharedBytes(src []byte, distance uint8) []SharedSections {
+
+	by_doc := make(map[int64]*SharedSections)
+	for _, query := range SimHashChunks(src, cs.options).Chunks {
+		counted := make(map[int64]bool) // a query chunk counts once per document
+
+		found, _, _ := cs.store.FindHash(query.Hash, distance)
+		sort.Slice(found, func(i, j int) bool { return found[i] < found[j] })
+		for _, hash_id := range found {
+			hash := cs.hashes[hash_id]
+			for _, ref := range cs.refs[hash] {
+				shared, exists := by_doc[ref.doc]
+				if !exists {
+					shared = &SharedSections{Id: ref.doc}
+					by_doc[ref.doc] = shared
+				}
+				shared.Sections = append(shared.Sections, SectionMatch{
+					Query:    query,
+					Match:    cs.docs[ref.doc][ref.chunk],
+					Distance: hamming_distance(query.Hash, hash),
+				})
+				if !counted[ref.doc] {
+					counted[ref.doc] = true
+					shared.Shared++
+				}
+			}
+		}
+	}
+
+	result := make([]SharedSections, 0, len(by_doc))
+	for _, shared := range by_doc {
+		result = append(result, *shared)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Shared != result[j].Shared {
+			return result[i].Shared > result[j].Shared
+		}
+		return result[i].Id < result[j].Id
+	})
+
+	return result
+}
@@ -0,0 +1,125 @@
+package simhashing
+
+import "testing"
+import "math/rand"
+import "strings"
+
+// random text with words of random letters
+func random_words(r *rand.Rand, n int) string {
+
+	var b strings.Builder
+	for b.Len() < n {
+		for i := 1 + r.Intn(8); i > 0; i-- {
+			b.WriteByte(byte('a' + r.Intn(26)))
+		}
+		b.WriteByte(' ')
+	}
+
+	return b.String()
+}
+
+var test_chunk_options = ChunkOptions{MinSize: 64, AvgSize: 256, MaxSize: 1024}
+
+func TestChunkBoundaries(t *testing.T) {
+
+	r := rand.New(rand.NewSource(1859))
+	text := []byte(random_words(r, 50*1000))
+
+	ends := ChunkBoundaries(text, test_chunk_options)
+	start := 0
+	for i, end := range ends {
+		size := end - start
+		if size > 1024 || (size < 64 && i != len(ends)-1) {
+			t.Errorf("Chunk %d has %d bytes", i, size)
+		}
+		start = end
+	}
+	if start != len(text) {
+		t.Errorf("Chunks end at %d, text has %d bytes", start, len(text))
+	}
+	if avg := len(text) / len(ends); avg < 128 || avg > 512 {
+		t.Errorf("Average chunk size is %d", avg)
+	}
+
+	// inserting something at the start only moves the first cuts
+	shifted := append([]byte("A Tale of Two Cities. "), text...)
+	moved := make(map[int]bool)
+	for _, end := range ends {
+		moved[end+22] = true
+	}
+	same := 0
+	for _, end := range ChunkBoundaries(shifted, test_chunk_options) {
+		if moved[end] {
+			same++
+		}
+	}
+	if same < len(ends)-3 {
+		t.Errorf("Only %d of %d cuts stayed put", same, len(ends))
+	}
+
+	if ends := ChunkBoundaries(nil, ChunkOptions{}); len(ends) != 0 {
+		t.Errorf("Empty text has chunks %v", ends)
+	}
+}
+
+func TestSimHashChunks(t *testing.T) {
+
+	r := rand.New(rand.NewSource(1859))
+	text := random_words(r, 20*1000)
+
+	ch := SimHashChunks([]byte(text), test_chunk_options)
+	for _, chunk := range ch.Chunks {
+		if chunk.Hash != SimHash(text[chunk.Offset:chunk.Offset+chunk.Length]) {
+			t.Errorf("Chunk at %d has the wrong hash", chunk.Offset)
+		}
+	}
+	if d := hamming_distance(ch.Hash, SimHash(text)); d > 6 {
+		t.Errorf("Document hash is %d bits from SimHash", d)
+	}
+}
+
+func TestChunkStore(t *testing.T) {
+
+	r := rand.New(rand.NewSource(1812))
+	sections := make([]string, 12)
+	for i := range sections {
+		sections[i] = random_words(r, 1500)
+	}
+
+	cs := NewChunkStore(test_chunk_options)
+	cs.Insert(strings.Join(sections[0:6], ""), 1)
+	cs.Insert(strings.Join(sections[6:12], ""), 2)
+	for i := int64(10); i < 20; i++ {
+		cs.Insert(random_words(r, 5000), i)
+	}
+	// boilerplate in lots of documents is only indexed once
+	for i := int64(100); i < 400; i++ {
+		cs.Insert("Copyright notice, all rights reserved.", i)
+	}
+
+	// a new document that quotes sections 2 and 3, with an edit, and some of its own
+	quoted := sections[2][:700] + "edited " + sections[2][700:] + sections[3]
+	query := random_words(r, 3000) + quoted + random_words(r, 3000)
+
+	found := cs.FindShared(query, 6)
+	if len(found) == 0 || found[0].Id != 1 || found[0].Shared < 4 {
+		t.Fatalf("Expected document 1 first, got %+v", found)
+	}
+	for _, shared := range found {
+		if shared.Id == 2 || shared.Id >= 100 {
+			t.Errorf("Document %d doesn't share anything", shared.Id)
+		}
+	}
+
+	// the matches point at the quoted sections
+	start := strings.Index(strings.Join(sections[0:6], ""), sections[2])
+	for _, section := range found[0].Sections {
+		if section.Match.Offset < start-1024 || section.Match.Offset > start+3000 {
+			t.Errorf("Match at %d is outside the quoted sections", section.Match.Offset)
+		}
+	}
+
+	if len(cs.Chunks(100)) != 1 || len(cs.refs[cs.Chunks(100)[0].Hash]) != 300 {
+		t.Error("Expected one boilerplate chunk with 300 references")
+	}
+}
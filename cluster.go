@@ -0,0 +1,134 @@
+package simhashing
+
+import "sort"
+
+// A group of items where every item is within distance k of at least one other item in the group
+// (so items at the ends of a chain can be a lot further apart)
+type Cluster struct {
+	Ids            []int64 // sorted
+	Representative int64   // the medoid with ClusterWithRepresentatives, otherwise just the lowest id
+}
+
+// Groups everything in the store into connected components: two items end up in the
+// same cluster if there's a chain of items between them with each step at most k apart.
+// Items without any near-duplicates are returned as clusters of 1.
+// Clusters are sorted by their lowest id.
+// This does one find() per item, so it's as fast as the trie is for radius k.
+func (s *SimStore) Cluster(k uint8) []Cluster {
+	clusters, _ := s.cluster(k)
+	return clusters
+}
+
+// Same as Cluster but also picks a representative for every cluster: the item with the
+// smallest total Hamming distance to the rest of the cluster (ties go to the lowest id).
+// That is quadratic in the size of a cluster, which is fine for near-duplicates but not
+// for a huge k where everything ends up in one big cluster.
+func (s *SimStore) ClusterWithRepresentatives(k uint8) []Cluster {
+
+	clusters, keys := s.cluster(k)
+
+	for c := range clusters {
+		ids := clusters[c].Ids
+		best := -1
+		for i := range ids {
+			total := 0
+			for j := range ids {
+				total += int(hamming_distance(keys[ids[i]], keys[ids[j]]))
+			}
+			if best == -1 || total < best {
+				best = total
+				clusters[c].Representative = ids[i]
+			}
+		}
+	}
+
+	return clusters
+}
+
+// returns the clusters and the key for every id
+// ids are what we cluster on, so if an id was inserted more than once (with different texts)
+// all of those are considered the same item (and the highest key is the one we keep)
+func (s *SimStore) cluster(k uint8) ([]Cluster, map[int64]uint64) {
+
+	var items []entry
+	s.walk(func(item entry) {
+		items = append(items, item)
+	})
+	// walk() goes over maps, sort so the result doesn't depend on their order
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].key != items[j].key {
+			return items[i].key < items[j].key
+		}
+		return items[i].id < items[j].id
+	})
+
+	keys := make(map[int64]uint64)
+	index := make(map[int64]int)
+	for _, item := range items {
+		if _, exists := index[item.id]; !exists {
+			index[item.id] = len(index)
+		}
+		keys[item.id] = item.key
+	}
+
+	sets := new_union_find(len(index))
+	for _, item := range items {
+		found, _, _ := s.find(item.key, k)
+		for _, id := range found {
+			sets.union(index[item.id], index[id])
+		}
+	}
+
+	members := make(map[int][]int64)
+	for id, i := range index {
+		root := sets.find(i)
+		members[root] = append(members[root], id)
+	}
+
+	clusters := make([]Cluster, 0, len(members))
+	for _, ids := range members {
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		clusters = append(clusters, Cluster{Ids: ids, Representative: ids[0]})
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].Ids[0] < clusters[j].Ids[0] })
+
+	return clusters, keys
+}
+
+// basic union-find with path halving and union by size
+type union_find struct {
+	parent []int
+	size   []int
+}
+
+func new_union_find(n int) *union_find {
+
+	u := &union_find{parent: make([]int, n), size: make([]int, n)}
+	for i := range u.parent {
+		u.parent[i] = i
+		u.size[i] = 1
+	}
+
+	return u
+}
+
+func (u *union_find) find(i int) int {
+	for u.parent[i] != i {
+		u.parent[i] = u.parent[u.parent[i]]
+		i = u.parent[i]
+	}
+	return i
+}
+
+func (u *union_find) union(a, b int) {
+
+	a, b = u.find(a), u.find(b)
+	if a == b {
+		return
+	}
+	if u.size[a] < u.size[b] {
+		a, b = b, a
+	}
+	u.parent[b] = a
+	u.size[a] += u.size[b]
+}
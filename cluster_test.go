@@ -0,0 +1,95 @@
+package simhashing
+
+import "testing"
+import "fmt"
+import "math/rand"
+
+func TestCluster(t *testing.T) {
+
+	simstore := NewSimStore()
+
+	// a chain: 0 and 1 are 1 bit apart, 1 and 2 are 1 bit apart, 0 and 2 are 2 bits apart
+	simstore.InsertHash(0x0, 1)
+	simstore.InsertHash(0x1, 2)
+	simstore.InsertHash(0x3, 3)
+	// far away from the chain, but 1 bit from each other
+	simstore.InsertHash(0xff00ff00ff00ff00, 4)
+	simstore.InsertHash(0xff00ff00ff00ff01, 5)
+	// all alone
+	simstore.InsertHash(0x00ff00ff00ff0000, 6)
+
+	clusters := simstore.ClusterWithRepresentatives(1)
+	if len(clusters) != 3 {
+		t.Fatalf("Expected 3 clusters, got %v", clusters)
+	}
+	if !int64array_sameset(clusters[0].Ids, []int64{1, 2, 3}) || clusters[0].Representative != 2 {
+		t.Errorf("Wrong first cluster %v", clusters[0])
+	}
+	if !int64array_sameset(clusters[1].Ids, []int64{4, 5}) || clusters[1].Representative != 4 {
+		t.Errorf("Wrong second cluster %v", clusters[1])
+	}
+	if !int64array_sameset(clusters[2].Ids, []int64{6}) {
+		t.Errorf("Wrong third cluster %v", clusters[2])
+	}
+
+	if len(simstore.Cluster(0)) != 6 {
+		t.Error("With distance 0 every item should be its own cluster")
+	}
+}
+
+func TestClusterDeterministic(t *testing.T) {
+
+	simstore := NewSimStore()
+	r := rand.New(rand.NewSource(2600))
+	for i := 0; i < 1000; i++ {
+		simstore.InsertHash(uint64(r.Int63()), int64(i))
+		simstore.InsertHash(uint64(r.Int63()), int64(i)) // every id twice, only one key counts
+	}
+
+	expected := fmt.Sprint(simstore.ClusterWithRepresentatives(16))
+	for run := 0; run < 10; run++ {
+		if got := fmt.Sprint(simstore.ClusterWithRepresentatives(16)); got != expected {
+			t.Fatalf("Run %d gave different clusters", run)
+		}
+	}
+}
+
+// compare with brute force union-find over all pairs, with enough items to have nodes
+func TestClusterNodes(t *testing.T) {
+
+	simstore := NewSimStore()
+
+	r := rand.New(rand.NewSource(5150))
+	keys := make([]uint64, 3*1000)
+	for i := range keys {
+		keys[i] = SimHash(fmt.Sprintf("%016x", r.Int63()))
+		simstore.InsertHash(keys[i], int64(i))
+	}
+
+	sets := new_union_find(len(keys))
+	for i := range keys {
+		for j := i + 1; j < len(keys); j++ {
+			if hamming_distance(keys[i], keys[j]) <= 6 {
+				sets.union(i, j)
+			}
+		}
+	}
+
+	for _, cluster := range simstore.Cluster(6) {
+		root := sets.find(int(cluster.Ids[0]))
+		size := 0
+		for _, id := range cluster.Ids {
+			if sets.find(int(id)) != root {
+				t.Fatalf("Id %d doesn't belong in cluster %v", id, cluster.Ids)
+			}
+		}
+		for i := range keys {
+			if sets.find(i) == root {
+				size++
+			}
+		}
+		if size != len(cluster.Ids) {
+			t.Fatalf("Cluster %v should have %d items", cluster.Ids, size)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import "bufio"
+import "flag"
+import "fmt"
+import "io"
+import "os"
+import "sort"
+
+import "github.com/niven/simhashing"
+
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("simhash "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
+
+// simhash hash: one "<hash>\t<name>" line per item
+func cmdHash(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+
+	var in inputFlags
+	fs := newFlagSet("hash", stderr)
+	in.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	w := bufio.NewWriter(stdout)
+	defer w.Flush()
+
+	return in.each(fs.Args(), stdin, func(it item) error {
+		_, err := fmt.Fprintf(w, "%016x\t%s\n", simhashing.SimHash(it.text), it.name)
+		return err
+	})
+}
+
+// simhash index: put every item in a SimStore and write a snapshot of it
+func cmdIndex(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+
+	var in inputFlags
+	fs := newFlagSet("index", stderr)
+	in.register(fs)
+	out := fs.String("o", "", "file to write the snapshot to (required)")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if *out == "" {
+		fmt.Fprintln(stderr, "simhash index: -o is required")
+		fs.Usage()
+		return errUsage
+	}
+
+	store := simhashing.NewSimStore()
+	err := in.each(fs.Args(), stdin, func(it item) error {
+		store.Insert(it.text, it.id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if _, err := store.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	keys, nodes := store.Stats()
+	fmt.Fprintf(stderr, "indexed %d items (%d nodes) into %s\n", keys, nodes, *out)
+
+	return nil
+}
+
+// simhash query: one "<name>\t<id>" line for every stored item within distance k of an input item
+func cmdQuery(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+
+	var in inputFlags
+	fs := newFlagSet("query", stderr)
+	in.register(fs)
+	snapshot := fs.String("snapshot", "", "snapshot to search in (required)")
+	k := fs.Uint("k", 3, "maximum Hamming distance")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if *snapshot == "" || *k > 64 {
+		fmt.Fprintln(stderr, "simhash query: -snapshot is required and -k must be at most 64")
+		fs.Usage()
+		return errUsage
+	}
+
+	f, err := os.Open(*snapshot)
+	if err != nil {
+		return err
+	}
+	store, err := simhashing.ReadSimStore(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(stdout)
+	defer w.Flush()
+
+	return in.each(fs.Args(), stdin, func(it item) error {
+		found, _, _ := store.Find(it.text, uint8(*k))
+		sort.Slice(found, func(i, j int) bool { return found[i] < found[j] })
+		for _, id := range found {
+			if _, err := fmt.Fprintf(w, "%s\t%d\n", it.name, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// simhash dedupe: clusters of files within distance k of each other,
+// one file per line and a blank line between clusters. Unique files are not printed.
+func cmdDedupe(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+
+	fs := newFlagSet("dedupe", stderr)
+	k := fs.Uint("k", 3, "maximum Hamming distance")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() == 0 || *k > 64 {
+		fmt.Fprintln(stderr, "simhash dedupe: need files or directories and -k must be at most 64")
+		fs.Usage()
+		return errUsage
+	}
+
+	files, err := expandPaths(fs.Args())
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	store := simhashing.NewSimStore()
+	for i, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		store.Insert(string(data), int64(i))
+	}
+
+	w := bufio.NewWriter(stdout)
+	defer w.Flush()
+
+	// ids are indices in the sorted file list, so clusters come out ordered by their first file
+	first := true
+	for _, cluster := range store.Cluster(uint8(*k)) {
+		if len(cluster.Ids) < 2 {
+			continue
+		}
+		if !first {
+			fmt.Fprintln(w)
+		}
+		first = false
+		for _, id := range cluster.Ids {
+			fmt.Fprintln(w, files[id])
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import "bufio"
+import "encoding/json"
+import "errors"
+import "flag"
+import "fmt"
+import "io"
+import "io/fs"
+import "os"
+import "path/filepath"
+import "strconv"
+import "strings"
+
+// returned when the flags didn't parse (the flag package already printed why)
+var errUsage = errors.New("usage")
+
+// a single thing to fingerprint
+type item struct {
+	name string // file name, file:line or the id from a JSONL record
+	id   int64
+	text string
+}
+
+// flags shared by the commands that read input
+type inputFlags struct {
+	lines      bool
+	jsonl      bool
+	text_field string
+	id_field   string
+}
+
+func (in *inputFlags) register(fs *flag.FlagSet) {
+	fs.BoolVar(&in.lines, "lines", false, "treat every line of the input files as a separate item")
+	fs.BoolVar(&in.jsonl, "jsonl", false, "input is JSON lines, one item per line")
+	fs.StringVar(&in.text_field, "text-field", "text", "JSONL field holding the text")
+	fs.StringVar(&in.id_field, "id-field", "id", "JSONL field holding the id (a number), defaults to the line number")
+}
+
+// calls fn for every item in the input: each file is one item, unless -lines or -jsonl
+// is set in which case each line is. Without files we read lines from stdin.
+// Ids are sequential starting at 1 unless a JSONL record has one.
+func (in *inputFlags) each(files []string, stdin io.Reader, fn func(it item) error) error {
+
+	next_id := int64(1)
+
+	if len(files) == 0 {
+		return in.eachLine("-", stdin, &next_id, fn)
+	}
+
+	for _, path := range files {
+		if !in.lines && !in.jsonl {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if err := fn(item{name: path, id: next_id, text: string(data)}); err != nil {
+				return err
+			}
+			next_id++
+			continue
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		err = in.eachLine(path, f, &next_id, fn)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (in *inputFlags) eachLine(name string, r io.Reader, next_id *int64, fn func(it item) error) error {
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024) // JSONL dumps can have long lines
+
+	line_number := 0
+	for scanner.Scan() {
+		line_number++
+		it := item{name: fmt.Sprintf("%s:%d", name, line_number), id: *next_id, text: scanner.Text()}
+		*next_id++
+
+		if in.jsonl {
+			if len(it.text) == 0 {
+				continue
+			}
+			if err := in.parseRecord(&it); err != nil {
+				return fmt.Errorf("%s: %v", it.name, err)
+			}
+		}
+
+		if err := fn(it); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// fills in text (and id, if present) from a JSON record
+func (in *inputFlags) parseRecord(it *item) error {
+
+	// numbers as json.Number, a float64 can't hold every int64 id
+	var record map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(it.text))
+	dec.UseNumber()
+	if err := dec.Decode(&record); err != nil {
+		return err
+	}
+
+	text, ok := record[in.text_field].(string)
+	if !ok {
+		return fmt.Errorf("no string field %q", in.text_field)
+	}
+	it.text = text
+
+	switch id := record[in.id_field].(type) {
+	case nil:
+		// keep the line based one
+	case json.Number:
+		n, err := strconv.ParseInt(id.String(), 10, 64)
+		if err != nil {
+			return fmt.Errorf("id field %q is not an integer: %s", in.id_field, id)
+		}
+		it.id = n
+		it.name = id.String()
+	case string:
+		n, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return fmt.Errorf("id field %q is not a number: %q", in.id_field, id)
+		}
+		it.id = n
+		it.name = id
+	default:
+		return fmt.Errorf("id field %q is not a number", in.id_field)
+	}
+
+	return nil
+}
+
+// expands directories into all the regular files in them
+func expandPaths(paths []string) ([]string, error) {
+
+	var files []string
+	for _, path := range paths {
+		err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.Type().IsRegular() {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
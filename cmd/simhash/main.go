@@ -0,0 +1,69 @@
+// simhash fingerprints text and finds near-duplicates from the shell.
+//
+// Usage:
+//
+//	simhash hash [-lines] [files...]                         print the simhash of every file (or line)
+//	simhash index -o snapshot [-lines] [-jsonl] [files...]   build a snapshot of a SimStore
+//	simhash query -snapshot f [-k 3] [-lines] [files...]     find stored items within distance k
+//	simhash dedupe [-k 3] files or directories...            print clusters of near-duplicate files
+//
+// Without files, input is read from stdin one item per line.
+// With -jsonl every line is a JSON object, the text and id are taken from
+// the fields named by -text-field and -id-field.
+package main
+
+import "fmt"
+import "io"
+import "os"
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+const usage = `usage: simhash <command> [flags] [files...]
+
+commands:
+  hash     print fingerprints for input lines or files
+  index    build a snapshot from input lines or files
+  query    find near-duplicates of the input in a snapshot
+  dedupe   print clusters of near-duplicate files
+
+run 'simhash <command> -h' for the flags of a command
+`
+
+// returns the exit code
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	var err error
+	switch args[0] {
+	case "hash":
+		err = cmdHash(args[1:], stdin, stdout, stderr)
+	case "index":
+		err = cmdIndex(args[1:], stdin, stdout, stderr)
+	case "query":
+		err = cmdQuery(args[1:], stdin, stdout, stderr)
+	case "dedupe":
+		err = cmdDedupe(args[1:], stdin, stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "simhash: unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+
+	if err == errUsage {
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "simhash %s: %v\n", args[0], err)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,102 @@
+package main
+
+import "testing"
+import "bytes"
+import "fmt"
+import "os"
+import "path/filepath"
+import "strings"
+
+import "github.com/niven/simhashing"
+
+// runs the command and returns stdout, failing the test on a non-zero exit code
+func runOK(t *testing.T, stdin string, args ...string) string {
+
+	var stdout, stderr bytes.Buffer
+	if code := run(args, strings.NewReader(stdin), &stdout, &stderr); code != 0 {
+		t.Fatalf("simhash %v exited with %d: %s", args, code, stderr.String())
+	}
+
+	return stdout.String()
+}
+
+func TestHash(t *testing.T) {
+
+	out := runOK(t, "hello world\nIt was the best of times\n", "hash")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %q", out)
+	}
+	if lines[1] != fmt.Sprintf("%016x\t-:2", simhashing.SimHash("It was the best of times")) {
+		t.Errorf("Wrong hash or name for line 2: %q", lines[1])
+	}
+}
+
+func TestIndexQuery(t *testing.T) {
+
+	dir := t.TempDir()
+	snapshot := filepath.Join(dir, "store.snap")
+
+	dump := `{"id": 10, "text": "It was the best of times, it was the worst of times,"}
+{"id": 20, "text": "it was the age of wisdom, it was the age of foolishness,"}
+`
+	runOK(t, dump, "index", "-jsonl", "-o", snapshot)
+
+	out := runOK(t, "It was the best of times, it was the worst of times,\n", "query", "-snapshot", snapshot, "-k", "0")
+	if out != "-:1\t10\n" {
+		t.Errorf("query returned %q", out)
+	}
+}
+
+func TestDedupe(t *testing.T) {
+
+	dir := t.TempDir()
+	write := func(name, text string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.txt", "It was the best of times, it was the worst of times, it was the age of wisdom")
+	write("b.txt", "It was the best of times, it was the worst of times, it was the age of wisdom")
+	write("c.txt", "we had everything before us, we had nothing before us")
+
+	out := runOK(t, "", "dedupe", "-k", "2", dir)
+	expected := filepath.Join(dir, "a.txt") + "\n" + filepath.Join(dir, "b.txt") + "\n"
+	if out != expected {
+		t.Errorf("dedupe returned %q, expected %q", out, expected)
+	}
+}
+
+func TestUsage(t *testing.T) {
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"frobnicate"}, strings.NewReader(""), &stdout, &stderr); code != 2 {
+		t.Errorf("Expected exit code 2 for an unknown command, got %d", code)
+	}
+	if code := run([]string{"index"}, strings.NewReader(""), &stdout, &stderr); code != 2 {
+		t.Errorf("Expected exit code 2 without -o, got %d", code)
+	}
+}
+
+func TestParseRecord(t *testing.T) {
+
+	in := &inputFlags{text_field: "text", id_field: "id"}
+
+	// 2^53 + 1 doesn't fit in a float64
+	it := item{text: `{"id": 9007199254740993, "text": "x"}`}
+	if err := in.parseRecord(&it); err != nil || it.id != 9007199254740993 || it.name != "9007199254740993" {
+		t.Errorf("big id parsed as %d (%q), %v", it.id, it.name, err)
+	}
+
+	it = item{text: `{"id": "-42", "text": "x"}`}
+	if err := in.parseRecord(&it); err != nil || it.id != -42 {
+		t.Errorf("string id parsed as %d, %v", it.id, err)
+	}
+
+	for _, bad := range []string{`{"id": 1.5, "text": "x"}`, `{"id": 1e3, "text": "x"}`, `{"id": 99999999999999999999, "text": "x"}`, `{"id": true, "text": "x"}`} {
+		it = item{text: bad}
+		if err := in.parseRecord(&it); err == nil {
+			t.Errorf("%s parsed as id %d", bad, it.id)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// simhashd serves a SimStore over HTTP/JSON.
+//
+// Endpoints (all request bodies are JSON objects with some of text, id, distance and k):
+//
+//	POST /insert    {"text": "...", "id": 1}
+//	POST /delete    {"text": "...", "id": 1}
+//	POST /find      {"text": "...", "distance": 3}
+//	POST /nearest   {"text": "...", "k": 10}
+//	POST /contains  {"text": "..."}
+//	GET  /stats
+//	GET  /metrics   (Prometheus text format)
+package main
+
+import "context"
+import "errors"
+import "flag"
+import "log"
+import "net/http"
+import "os"
+import "os/signal"
+import "syscall"
+import "time"
+
+import "github.com/niven/simhashing"
+
+func main() {
+
+	addr := flag.String("addr", ":8080", "address to listen on")
+	snapshot := flag.String("snapshot", "", "snapshot file to load at startup (optional)")
+	max_body := flag.Int64("max-body", 1<<20, "maximum request body size in bytes")
+	max_k := flag.Int("max-k", 1000, "maximum number of results /nearest returns")
+	grace := flag.Duration("shutdown-timeout", 10*time.Second, "how long to wait for requests to finish on shutdown")
+	flag.Parse()
+
+	store, err := loadStore(*snapshot)
+	if err != nil {
+		log.Fatalf("loading snapshot %s: %v", *snapshot, err)
+	}
+	keys, nodes := store.Stats()
+	log.Printf("store has %d keys in %d nodes", keys, nodes)
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           newServer(store, *max_body, *max_k).routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// stop accepting requests on SIGINT/SIGTERM, but let the running ones finish
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// ListenAndServe returns as soon as Shutdown starts, so wait for it to finish
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+		log.Printf("shutting down")
+		shutdown_ctx, cancel := context.WithTimeout(context.Background(), *grace)
+		defer cancel()
+		if err := srv.Shutdown(shutdown_ctx); err != nil {
+			log.Printf("shutdown: %v", err)
+		}
+	}()
+
+	log.Printf("listening on %s", *addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	<-done
+}
+
+// returns an empty store if there is no snapshot to load
+func loadStore(path string) (*simhashing.SimStore, error) {
+
+	if path == "" {
+		return simhashing.NewSimStore(), nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return simhashing.ReadSimStore(f)
+}
@@ -0,0 +1,210 @@
+package main
+
+import "encoding/json"
+import "errors"
+import "fmt"
+import "net/http"
+import "sync"
+
+import "github.com/niven/simhashing"
+
+// the SimStore isn't safe for concurrent use, so the server keeps its own lock
+type server struct {
+	mu       sync.RWMutex
+	store    *simhashing.SimStore
+	metrics  *simhashing.Metrics
+	max_body int64 // max request size in bytes
+	max_k    int   // max k for /nearest
+}
+
+func newServer(store *simhashing.SimStore, max_body int64, max_k int) *server {
+
+	metrics := simhashing.NewMetrics()
+	store.SetMetrics(metrics)
+
+	return &server{store: store, metrics: metrics, max_body: max_body, max_k: max_k}
+}
+
+// all endpoints take and return JSON
+func (s *server) routes() http.Handler {
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/insert", only("POST", s.handleInsert))
+	mux.HandleFunc("/delete", only("POST", s.handleDelete))
+	mux.HandleFunc("/find", only("POST", s.handleFind))
+	mux.HandleFunc("/nearest", only("POST", s.handleNearest))
+	mux.HandleFunc("/contains", only("POST", s.handleContains))
+	mux.HandleFunc("/stats", only("GET", s.handleStats))
+	mux.HandleFunc("/metrics", only("GET", s.handleMetrics))
+
+	return mux
+}
+
+// rejects requests with any other method than the given one
+func only(method string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, "use "+method)
+			return
+		}
+		h(w, r)
+	}
+}
+
+type request struct {
+	Text     string `json:"text"`
+	Id       int64  `json:"id"`
+	Distance uint8  `json:"distance"`
+	K        int    `json:"k"`
+}
+
+type match struct {
+	Id       int64 `json:"id"`
+	Distance uint8 `json:"distance"`
+}
+
+// reads the JSON body into req, writes an error response and returns false if that didn't work
+func (s *server) decode(w http.ResponseWriter, r *http.Request, req *request) bool {
+
+	r.Body = http.MaxBytesReader(w, r.Body, s.max_body)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(req); err != nil {
+		var too_big *http.MaxBytesError
+		if errors.As(err, &too_big) {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request larger than %d bytes", too_big.Limit))
+		} else {
+			writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		}
+		return false
+	}
+
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+func (s *server) handleInsert(w http.ResponseWriter, r *http.Request) {
+
+	var req request
+	if !s.decode(w, r, &req) {
+		return
+	}
+
+	// defer, so a panic in the store doesn't leave the lock held for every request after it
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hash := s.store.Algorithm().Hash(req.Text)
+	s.store.InsertHash(hash, req.Id)
+
+	writeJSON(w, http.StatusOK, map[string]string{"hash": fmt.Sprintf("%016x", hash)})
+}
+
+func (s *server) handleDelete(w http.ResponseWriter, r *http.Request) {
+
+	var req request
+	if !s.decode(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deleted := s.store.Delete(req.Text, req.Id)
+
+	writeJSON(w, http.StatusOK, map[string]bool{"deleted": deleted})
+}
+
+func (s *server) handleFind(w http.ResponseWriter, r *http.Request) {
+
+	var req request
+	if !s.decode(w, r, &req) {
+		return
+	}
+	if req.Distance > 64 {
+		writeError(w, http.StatusBadRequest, "distance must be between 0 and 64")
+		return
+	}
+
+	// big distances can take a long time, stop if the client goes away
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	found, stats, err := s.store.FindContext(r.Context(), req.Text, req.Distance, simhashing.Budget{})
+	if err != nil {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"ids":           found,
+		"keys_checked":  stats.KeysChecked,
+		"nodes_checked": stats.NodesChecked,
+	})
+}
+
+func (s *server) handleNearest(w http.ResponseWriter, r *http.Request) {
+
+	var req request
+	if !s.decode(w, r, &req) {
+		return
+	}
+	if req.K == 0 {
+		req.K = 1
+	}
+	if req.K < 0 || req.K > s.max_k {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("k must be between 1 and %d", s.max_k))
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	nearest := s.store.FindNearest(req.Text, req.K)
+
+	matches := make([]match, len(nearest))
+	for i, m := range nearest {
+		matches[i] = match{Id: m.Id, Distance: m.Distance}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"matches": matches})
+}
+
+func (s *server) handleContains(w http.ResponseWriter, r *http.Request) {
+
+	var req request
+	if !s.decode(w, r, &req) {
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	present, id := s.store.Contains(req.Text)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"present": present, "id": id})
+}
+
+func (s *server) handleStats(w http.ResponseWriter, r *http.Request) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys, nodes := s.store.Stats()
+	algorithm := s.store.Algorithm().ID
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"keys": keys, "nodes": nodes, "algorithm": algorithm})
+}
+
+// metrics walk the tree, so they need the lock like every other read
+func (s *server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	s.metrics.Handler().ServeHTTP(w, r)
+}
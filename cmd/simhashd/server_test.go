@@ -0,0 +1,125 @@
+package main
+
+import "testing"
+import "encoding/json"
+import "fmt"
+import "net/http"
+import "net/http/httptest"
+import "strings"
+
+import "github.com/niven/simhashing"
+
+// does a request against the handler and decodes the JSON response into out
+func do(t *testing.T, h http.Handler, method, path, body string, out interface{}) int {
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: bad JSON response %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+
+	return rec.Code
+}
+
+func TestServer(t *testing.T) {
+
+	h := newServer(simhashing.NewSimStore(), 1<<10, 100).routes()
+
+	var inserted struct{ Hash string }
+	do(t, h, "POST", "/insert", `{"text": "It was the best of times, it was the worst of times,", "id": 1}`, &inserted)
+	if inserted.Hash != fmt.Sprintf("%016x", simhashing.SimHash("It was the best of times, it was the worst of times,")) {
+		t.Errorf("insert returned hash %q", inserted.Hash)
+	}
+	do(t, h, "POST", "/insert", `{"text": "it was the age of wisdom, it was the age of foolishness,", "id": 2}`, nil)
+
+	var contains struct {
+		Present bool
+		Id      int64
+	}
+	do(t, h, "POST", "/contains", `{"text": "it was the age of wisdom, it was the age of foolishness,"}`, &contains)
+	if !contains.Present || contains.Id != 2 {
+		t.Errorf("contains returned %+v", contains)
+	}
+
+	var find struct{ Ids []int64 }
+	do(t, h, "POST", "/find", `{"text": "It was the best of times, it was the worst of times,", "distance": 0}`, &find)
+	if len(find.Ids) != 1 || find.Ids[0] != 1 {
+		t.Errorf("find returned %+v", find)
+	}
+
+	var nearest struct {
+		Matches []struct {
+			Id       int64
+			Distance uint8
+		}
+	}
+	do(t, h, "POST", "/nearest", `{"text": "It was the best of times and it was the worst of times", "k": 2}`, &nearest)
+	if len(nearest.Matches) != 2 || nearest.Matches[0].Id != 1 {
+		t.Errorf("nearest returned %+v", nearest)
+	}
+
+	var deleted struct{ Deleted bool }
+	do(t, h, "POST", "/delete", `{"text": "It was the best of times, it was the worst of times,", "id": 1}`, &deleted)
+	if !deleted.Deleted {
+		t.Error("delete didn't delete")
+	}
+
+	var stats struct {
+		Keys, Nodes int
+		Algorithm   string
+	}
+	do(t, h, "GET", "/stats", "", &stats)
+	if stats.Keys != 1 || stats.Algorithm != simhashing.DefaultAlgorithm {
+		t.Errorf("stats returned %+v", stats)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(rec.Body.String(), "simhash_inserts_total 2\n") {
+		t.Errorf("metrics returned %q", rec.Body.String())
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+
+	h := newServer(simhashing.NewSimStore(), 64, 100).routes()
+
+	if code := do(t, h, "POST", "/find", `{"text": "x", "distance": 65}`, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a bad distance, got %d", code)
+	}
+	if code := do(t, h, "POST", "/insert", `{"text": `, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for bad JSON, got %d", code)
+	}
+	big := `{"text": "` + strings.Repeat("a", 100) + `", "id": 1}`
+	if code := do(t, h, "POST", "/insert", big, nil); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a big request, got %d", code)
+	}
+	if code := do(t, h, "POST", "/nearest", `{"k": 1000000000000}`, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a huge k, got %d", code)
+	}
+	if code := do(t, h, "GET", "/insert", "", nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for GET /insert, got %d", code)
+	}
+}
+
+func TestServerDuplicates(t *testing.T) {
+
+	h := newServer(simhashing.NewSimStore(), 1<<10, 100).routes()
+
+	// more copies of a key than fit in a node used to panic in the store and leave the lock held
+	for i := 0; i < 300; i++ {
+		if code := do(t, h, "POST", "/insert", `{"text":"same","id":1}`, nil); code != http.StatusOK {
+			t.Fatalf("insert %d returned %d", i, code)
+		}
+	}
+
+	var stats struct{ Keys int }
+	do(t, h, "GET", "/stats", "", &stats)
+	if stats.Keys != 300 {
+		t.Errorf("stats returned %+v", stats)
+	}
+}
@@ -0,0 +1,147 @@
+package simhashing
+
+import "sort"
+
+// Containment: a simhash says how alike two documents are as a whole, so a paragraph quoted
+// in a long essay looks nothing like the essay. Containment is the fraction of a query's
+// shingles that are in a document, which is 1 for the paragraph whatever else the essay says.
+//
+// Keeping every shingle of every document is a lot, so we keep a sample: the shingles whose
+// (mixed) hash ends in SampleBits zeros. That picks the same shingles in every document, so
+// the fraction of the query's sample that's in a document's sample estimates the containment.
+
+// How a ContainmentIndex shingles and samples
+type ContainmentOptions struct {
+	Window     int // words in a shingle, 0 for the default
+	SampleBits int // keep 1 in 2^SampleBits shingles, 0 keeps them all
+}
+
+var DefaultContainmentOptions = ContainmentOptions{Window: 5, SampleBits: 3}
+
+// How much of a query is in a stored document
+type Containment struct {
+	Id       int64
+	Ratio    float64 // estimated fraction of the query's shingles that are in the document
+	Coverage float64 // estimated fraction of the document's shingles that are in the query
+	Shared   int     // sampled shingles they have in common
+	Distance uint8   // between the SimHashes of the two
+}
+
+// An index of sampled shingles of documents, to find the ones that contain (part of) a query
+type ContainmentIndex struct {
+	options  ContainmentOptions
+	postings map[uint64][]int64 // sampled shingle -> the documents that have it
+	docs     map[int64]containment_doc
+}
+
+type containment_doc struct {
+	hash    uint64 // SimHash
+	samples int    // how many distinct sampled shingles
+}
+
+// Creates a new ContainmentIndex
+func NewContainmentIndex(opts ContainmentOptions) *ContainmentIndex {
+
+	if opts.Window < 1 {
+		opts.Window = DefaultContainmentOptions.Window
+	}
+	if opts.SampleBits < 0 || opts.SampleBits > 63 {
+		opts.SampleBits = DefaultContainmentOptions.SampleBits
+	}
+
+	return &ContainmentIndex{
+		options:  opts,
+		postings: make(map[uint64][]int64),
+		docs:     make(map[int64]containment_doc),
+	}
+}
+
+// the distinct sampled shingles of text
+func (ci *ContainmentIndex) sample(text string) map[uint64]bool {
+
+	samples := make(map[uint64]bool)
+	mask := uint64(1)<<uint(ci.options.SampleBits) - 1
+	keep := func(h uint64) {
+		if h&mask == 0 { // sum() is already mixed, so the low bits are as good as any
+			samples[h] = true
+		}
+	}
+
+	r := new_roller(ci.options.Window, false)
+	rolling_tokenizers["words"](text, func(v uint64) {
+		r.roll(v)
+		if r.n >= ci.options.Window {
+			keep(r.sum())
+		}
+	})
+	// shorter than a shingle: all of it is the one shingle, and it's always kept so there's
+	// something to compare (it only ever matches the same short text though)
+	if r.n > 0 && r.n < ci.options.Window {
+		samples[r.sum()] = true
+	}
+
+	return samples
+}
+
+// Adds a document. Returns false (and does nothing) if id is already in the index.
+func (ci *ContainmentIndex) Insert(text string, id int64) bool {
+
+	if _, exists := ci.docs[id]; exists {
+		return false
+	}
+
+	samples := ci.sample(text)
+	for h := range samples {
+		ci.postings[h] = append(ci.postings[h], id)
+	}
+	ci.docs[id] = containment_doc{hash: SimHash(text), samples: len(samples)}
+
+	return true
+}
+
+// Returns the number of documents in the index
+func (ci *ContainmentIndex) Len() int {
+	return len(ci.docs)
+}
+
+// Returns the (at most) k documents that contain the most of text, highest Ratio first.
+// Documents that share nothing with text aren't returned. The estimate is only as good as
+// the sample is big: a query needs a few times 2^SampleBits words for it to mean much.
+func (ci *ContainmentIndex) Find(text string, k int) []Containment {
+
+	samples := ci.sample(text)
+	if len(samples) == 0 || k < 1 {
+		return nil
+	}
+
+	shared := make(map[int64]int)
+	for h := range samples {
+		for _, id := range ci.postings[h] {
+			shared[id]++
+		}
+	}
+
+	target := SimHash(text)
+	found := make([]Containment, 0, len(shared))
+	for id, n := range shared {
+		doc := ci.docs[id]
+		found = append(found, Containment{
+			Id:       id,
+			Ratio:    float64(n) / float64(len(samples)),
+			Coverage: float64(n) / float64(doc.samples),
+			Shared:   n,
+			Distance: hamming_distance(target, doc.hash),
+		})
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].Ratio != found[j].Ratio {
+			return found[i].Ratio > found[j].Ratio
+		}
+		return found[i].Id < found[j].Id
+	})
+	if len(found) > k {
+		found = found[:k]
+	}
+
+	return found
+}
@@ -0,0 +1,62 @@
+package simhashing
+
+import "testing"
+import "math"
+import "math/rand"
+import "strings"
+
+func TestContainmentIndex(t *testing.T) {
+
+	r := rand.New(rand.NewSource(1984))
+	ci := NewContainmentIndex(DefaultContainmentOptions)
+
+	essay := random_words(r, 30*1000)
+	ci.Insert(essay, 1)
+	half := essay[10*1000 : 13*1000]
+	paragraph := essay[10*1000 : 16*1000]
+	paragraph = paragraph[strings.IndexByte(paragraph, ' ')+1:] // whole words only
+
+	// a document with half of the paragraph in it
+	ci.Insert(random_words(r, 5000)+half+random_words(r, 5000), 2)
+	for i := int64(10); i < 50; i++ {
+		ci.Insert(random_words(r, 10*1000), i)
+	}
+	if ci.Insert("again", 1) {
+		t.Error("Inserting an id twice should fail")
+	}
+	if ci.Len() != 42 {
+		t.Errorf("Index has %d documents", ci.Len())
+	}
+
+	found := ci.Find(paragraph, 5)
+	if len(found) != 2 || found[0].Id != 1 || found[1].Id != 2 {
+		t.Fatalf("Expected documents 1 and 2, got %+v", found)
+	}
+	if found[0].Ratio < 0.9 {
+		t.Errorf("The essay contains all of the paragraph, estimated %.2f", found[0].Ratio)
+	}
+	if math.Abs(found[0].Coverage-0.2) > 0.1 {
+		t.Errorf("The paragraph is a fifth of the essay, estimated %.2f", found[0].Coverage)
+	}
+	if math.Abs(found[1].Ratio-0.5) > 0.2 {
+		t.Errorf("Document 2 contains half of the paragraph, estimated %.2f", found[1].Ratio)
+	}
+	if found[0].Distance < 8 {
+		t.Errorf("The simhashes of paragraph and essay shouldn't be close, distance is %d", found[0].Distance)
+	}
+
+	if found := ci.Find(paragraph, 1); len(found) != 1 || found[0].Id != 1 {
+		t.Errorf("Expected only the best one, got %+v", found)
+	}
+	if found := ci.Find(random_words(r, 2000), 5); len(found) != 0 {
+		t.Errorf("Expected nothing for a new text, got %+v", found)
+	}
+
+	// without sampling it's exact
+	all := NewContainmentIndex(ContainmentOptions{Window: 3})
+	all.Insert("a b c d e f", 1)
+	found = all.Find("b c d e x", 1)
+	if len(found) != 1 || found[0].Ratio != 2.0/3 || found[0].Coverage != 2.0/4 {
+		t.Errorf("Expected exact ratios, got %+v", found)
+	}
+}
@@ -0,0 +1,61 @@
+package simhashing
+
+// Returns the number of items with a Hamming Distance of k or less to text,
+// without building the list of results like Find does
+func (s *SimStore) Count(text string, k uint8) int {
+	return s.CountHash(s.hash(text), k)
+}
+
+// Same as Count, but for an already computed hash
+func (s *SimStore) CountHash(target uint64, k uint8) (count int) {
+
+	for _, c := range s.CountHashByDistance(target, k) {
+		count += c
+	}
+
+	return
+}
+
+// Returns how many items there are at every distance from text, up to max_k:
+// counts[d] is the number of items at exactly distance d
+func (s *SimStore) CountByDistance(text string, max_k uint8) (counts []int) {
+	return s.CountHashByDistance(s.hash(text), max_k)
+}
+
+// Same as CountByDistance, but for an already computed hash
+func (s *SimStore) CountHashByDistance(target uint64, max_k uint8) (counts []int) {
+
+	if max_k > 64 {
+		max_k = 64
+	}
+	counts = make([]int, max_k+1)
+	s.count(target, max_k, counts)
+
+	return
+}
+
+// walks the tree like find() does, distance is what we have left to 'spend'
+func (s *SimStore) count(target uint64, distance uint8, counts []int) {
+
+	if len(s.nodes) > 0 {
+		b := int((level_chunks[s.level] & target) >> (s.level * bits_per_key)) // this gets you the Nth byte
+		end := min(8, distance)
+		for i := uint8(0); i <= end; i++ {
+			for _, d := range distance_table[b][i] {
+				subtree, exists := s.nodes[d]
+				if exists {
+					subtree.count(target, distance-i, counts)
+				}
+			}
+		}
+		return
+	}
+
+	// we need the actual distance for the histogram, not just the part below this level
+	max_k := uint8(len(counts) - 1)
+	for _, item := range s.values {
+		if d := hamming_distance(item.key, target); d <= max_k {
+			counts[d]++
+		}
+	}
+}
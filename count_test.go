@@ -0,0 +1,48 @@
+package simhashing
+
+import "testing"
+import "fmt"
+import "math/rand"
+
+func TestCount(t *testing.T) {
+
+	simstore := NewSimStore()
+
+	r := rand.New(rand.NewSource(1701))
+	var keys []uint64
+	for i := 0; i < 5*1000; i++ {
+		text := fmt.Sprintf("%016x", r.Int63())
+		simstore.Insert(text, int64(i))
+		keys = append(keys, SimHash(text))
+	}
+
+	for q := 0; q < 10; q++ {
+		query := fmt.Sprintf("%016x", r.Int63())
+		target := SimHash(query)
+
+		var expected [21]int
+		for _, key := range keys {
+			if d := hamming_distance(key, target); d <= 20 {
+				expected[d]++
+			}
+		}
+
+		counts := simstore.CountByDistance(query, 20)
+		total := 0
+		for d, c := range counts {
+			if c != expected[d] {
+				t.Errorf("CountByDistance has %d items at distance %d, expected %d", c, d, expected[d])
+			}
+			total += c
+		}
+
+		if simstore.Count(query, 20) != total {
+			t.Errorf("Count doesn't match CountByDistance")
+		}
+
+		found, _, _ := simstore.Find(query, 12)
+		if simstore.Count(query, 12) != len(found) {
+			t.Errorf("Count returned %d, Find found %d", simstore.Count(query, 12), len(found))
+		}
+	}
+}
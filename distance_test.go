@@ -0,0 +1,122 @@
+package simhashing
+
+import "testing"
+import "math/rand"
+
+// the old table lookup version of hamming_distance, kept around to benchmark against
+func hamming_distance_table(a uint64, b uint64) (distance uint8) {
+
+	for a^b != 0 {
+		distance += hamming[uint8(a)][uint8(b)]
+		a = a >> bit_length
+		b = b >> bit_length
+	}
+
+	return
+}
+
+func random_keys(n int) []uint64 {
+
+	r := rand.New(rand.NewSource(4004))
+	keys := make([]uint64, n)
+	for i := range keys {
+		keys[i] = r.Uint64()
+	}
+
+	return keys
+}
+
+func TestDistanceKernels(t *testing.T) {
+
+	keys := random_keys(1003) // not a multiple of 4, so the tail loop runs too
+	target := keys[17] ^ 0x5
+
+	distances := Distances(target, keys, nil)
+	var hits []int
+	hits = WithinDistance(target, keys, 30, hits)
+
+	values := make([]entry, len(keys))
+	for i, key := range keys {
+		values[i] = entry{key: key, id: int64(i)}
+	}
+	mask := masks[2]
+	masked_hits := entries_within(values, target, mask, 20, nil)
+
+	h, m := 0, 0
+	for i, key := range keys {
+		d := hamming_distance_table(key, target)
+		if distances[i] != d || hamming_distance(key, target) != d || HammingDistance(key, target) != int(d) {
+			t.Fatalf("Distances disagree for key %d", i)
+		}
+		if d <= 30 {
+			if h >= len(hits) || hits[h] != i {
+				t.Fatalf("WithinDistance missed key %d", i)
+			}
+			h++
+		}
+		if hamming_distance_table(key&mask, target&mask) <= 20 {
+			if m >= len(masked_hits) || masked_hits[m] != i {
+				t.Fatalf("entries_within missed key %d", i)
+			}
+			m++
+		}
+	}
+	if h != len(hits) || m != len(masked_hits) {
+		t.Errorf("Kernels returned extra hits")
+	}
+}
+
+func BenchmarkHammingDistanceTable(b *testing.B) {
+
+	keys := random_keys(256)
+	var total int
+	for i := 0; i < b.N; i++ {
+		for _, key := range keys {
+			total += int(hamming_distance_table(key, keys[0]))
+		}
+	}
+	_ = total
+}
+
+func BenchmarkHammingDistancePopcount(b *testing.B) {
+
+	keys := random_keys(256)
+	var total int
+	for i := 0; i < b.N; i++ {
+		for _, key := range keys {
+			total += int(hamming_distance(key, keys[0]))
+		}
+	}
+	_ = total
+}
+
+func BenchmarkDistances(b *testing.B) {
+
+	keys := random_keys(256)
+	out := make([]uint8, len(keys))
+	for i := 0; i < b.N; i++ {
+		out = Distances(keys[0], keys, out)
+	}
+}
+
+func BenchmarkWithinDistance(b *testing.B) {
+
+	keys := random_keys(256)
+	hits := make([]int, 0, len(keys))
+	for i := 0; i < b.N; i++ {
+		hits = WithinDistance(keys[0], keys, 24, hits[:0])
+	}
+}
+
+func BenchmarkFindScanAll(b *testing.B) {
+
+	simstore := NewSimStore()
+	for i, key := range random_keys(100 * 1000) {
+		simstore.InsertHash(key, int64(i))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		simstore.FindScanAll(0x0123456789abcdef, 20)
+	}
+}
@@ -0,0 +1,87 @@
+package simhashing
+
+import "fmt"
+import "sort"
+import "strings"
+
+// Why two texts have the simhashes they have, see Explain()
+type Explanation struct {
+	HashA, HashB     uint64
+	Distance         int
+	DifferingBits    []int    // bit positions (0 is the LSB) where the hashes differ
+	MarginsA         [64]int  // the vote per bit for a: > 0 means the bit is set, the size is how sure it is
+	MarginsB         [64]int  // same for b
+	OnlyInA, OnlyInB []string // shingles that only appear on one side (sorted, no duplicates)
+}
+
+// Explains the difference between the simhashes of a and b.
+// Bits with small margins are the ones that flip under tiny edits, the
+// unique shingles show which parts of the texts pushed them over.
+func Explain(a, b string) *Explanation {
+
+	e := &Explanation{
+		MarginsA: simhash_counts(a),
+		MarginsB: simhash_counts(b),
+	}
+	e.HashA = simhash_from_counts(&e.MarginsA)
+	e.HashB = simhash_from_counts(&e.MarginsB)
+	e.Distance = HammingDistance(e.HashA, e.HashB)
+
+	e.DifferingBits = []int{}
+	for i := 0; i < 64; i++ {
+		if (e.HashA^e.HashB)&(1<<uint(i)) != 0 {
+			e.DifferingBits = append(e.DifferingBits, i)
+		}
+	}
+
+	shingles_a := shingle_set(a)
+	shingles_b := shingle_set(b)
+	e.OnlyInA = difference(shingles_a, shingles_b)
+	e.OnlyInB = difference(shingles_b, shingles_a)
+
+	return e
+}
+
+func shingle_set(src string) map[string]bool {
+
+	set := make(map[string]bool)
+	for _, shingle := range Tokenize_stride(src, shingle_length) {
+		set[shingle] = true
+	}
+
+	return set
+}
+
+// everything in a that's not in b, sorted
+func difference(a, b map[string]bool) []string {
+
+	out := []string{}
+	for shingle := range a {
+		if !b[shingle] {
+			out = append(out, shingle)
+		}
+	}
+	sort.Strings(out)
+
+	return out
+}
+
+// Renders the explanation for humans
+func (e *Explanation) String() string {
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "a: %016x\nb: %016x\ndistance %d\n", e.HashA, e.HashB, e.Distance)
+
+	if len(e.DifferingBits) > 0 {
+		fmt.Fprintf(&b, "\nbit  margin a  margin b\n")
+		for _, bit := range e.DifferingBits {
+			fmt.Fprintf(&b, "% 3d  % 8d  % 8d\n", bit, e.MarginsA[bit], e.MarginsB[bit])
+		}
+	}
+
+	fmt.Fprintf(&b, "\nonly in a (%d): %q\n", len(e.OnlyInA), e.OnlyInA)
+	fmt.Fprintf(&b, "only in b (%d): %q\n", len(e.OnlyInB), e.OnlyInB)
+
+	return b.String()
+}
@@ -0,0 +1,44 @@
+package simhashing
+
+import "testing"
+import "strings"
+
+func TestExplain(t *testing.T) {
+
+	a := "It was the best of times, it was the worst of times,"
+	b := "It was the best of times and it was the worst of times"
+	e := Explain(a, b)
+
+	if e.HashA != SimHash(a) || e.HashB != SimHash(b) {
+		t.Error("Explain doesn't agree with SimHash")
+	}
+	if e.Distance != len(e.DifferingBits) || e.Distance != HammingDistance(e.HashA, e.HashB) {
+		t.Errorf("Distance %d doesn't match differing bits %v", e.Distance, e.DifferingBits)
+	}
+
+	for _, bit := range e.DifferingBits {
+		// the sides voted differently on every differing bit
+		if (e.MarginsA[bit] > 0) == (e.MarginsB[bit] > 0) {
+			t.Errorf("Bit %d differs but the margins %d and %d agree", bit, e.MarginsA[bit], e.MarginsB[bit])
+		}
+	}
+
+	if !stringarray_equal(e.OnlyInA, []string{", i", "es,", "s, "}) {
+		t.Errorf("Unexpected shingles only in a: %q", e.OnlyInA)
+	}
+	if !stringarray_equal(e.OnlyInB, []string{" an", "and", "d i", "es ", "nd ", "s a"}) {
+		t.Errorf("Unexpected shingles only in b: %q", e.OnlyInB)
+	}
+
+	if !strings.Contains(e.String(), "distance ") {
+		t.Errorf("Unexpected text %q", e.String())
+	}
+}
+
+func TestExplainSame(t *testing.T) {
+
+	e := Explain("hello world", "hello world")
+	if e.Distance != 0 || len(e.DifferingBits) != 0 || len(e.OnlyInA) != 0 || len(e.OnlyInB) != 0 {
+		t.Errorf("Identical texts should not differ: %+v", e)
+	}
+}
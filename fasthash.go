@@ -0,0 +1,141 @@
+package simhashing
+
+// The fast path for SimHash. The straightforward way makes a string for every shingle, hashes
+// it and then walks over all 64 bits of the hash to vote, which is a lot of unpredictable
+// branches. Here we slide over the bytes, start each shingle's Strong64 from a table with
+// the first byte already done, and count the votes for 8 bits at a time.
+
+// strong64_first[b] is Strong64 after its first byte b
+var strong64_first [256]uint64
+
+// one byte of Strong64
+func strong64_step(h uint64, b uint8) uint64 {
+	h = (h * _HMULT) ^ byteTable[b]
+	return (h * _HMULT) ^ byteTable[0]
+}
+
+// strong64_shingle and shingle_votes are written for 3 byte shingles, these stop the build
+// (negative array length) if shingle_length ever changes without them
+var _ [shingle_length - 3]struct{}
+var _ [3 - shingle_length]struct{}
+
+// Strong64 of the 3 byte shingle a, b, c
+func strong64_shingle(a, b, c uint8) uint64 {
+	return strong64_step(strong64_step(strong64_first[a], b), c)
+}
+
+// Strong64 for strings and bytes, so we don't need a string for every shingle
+func strong64_of[T string | []byte](in T) uint64 {
+
+	h := _HSTART
+	for i := 0; i < len(in); i++ {
+		h = strong64_step(h, in[i])
+	}
+
+	return h
+}
+
+// SimHash votes for every shingle of src (or for all of it, if it's shorter than a shingle)
+func shingle_votes[T string | []byte](src T, c *bit_counter) {
+
+	if len(src) < shingle_length {
+		c.add(strong64_of(src))
+		return
+	}
+
+	for i := 0; i+shingle_length <= len(src); i++ {
+		c.add(strong64_shingle(src[i], src[i+1], src[i+2]))
+	}
+}
+
+// spread[b] has bit k of b in byte k, so adding them up counts 8 bits in one go
+var spread [256]uint64
+
+func init() {
+	for b := 0; b < 256; b++ {
+		for k := 0; k < 8; k++ {
+			spread[b] |= uint64(b>>k&1) << (8 * k)
+		}
+	}
+}
+
+// Counts how often every bit is set in a lot of hashes. That's all the votes need:
+// bit i got ones[i] votes for and n-ones[i] against.
+type bit_counter struct {
+	lanes   [8]uint64 // byte k of lanes[j] counts bit 8*j+k for the last pending hashes
+	pending int       // a lane byte overflows after 255 hashes, so we move them to ones before that
+	ones    [64]int
+	n       int
+}
+
+func (c *bit_counter) add(h uint64) {
+
+	c.lanes[0] += spread[uint8(h)]
+	c.lanes[1] += spread[uint8(h>>8)]
+	c.lanes[2] += spread[uint8(h>>16)]
+	c.lanes[3] += spread[uint8(h>>24)]
+	c.lanes[4] += spread[uint8(h>>32)]
+	c.lanes[5] += spread[uint8(h>>40)]
+	c.lanes[6] += spread[uint8(h>>48)]
+	c.lanes[7] += spread[uint8(h>>56)]
+	c.n++
+
+	c.pending++
+	if c.pending == 255 {
+		c.flush()
+	}
+}
+
+func (c *bit_counter) flush() {
+
+	for j, lane := range c.lanes {
+		for k := 0; k < 8; k++ {
+			c.ones[8*j+k] += int(lane >> (8 * uint(k)) & 0xff)
+		}
+	}
+	c.lanes = [8]uint64{}
+	c.pending = 0
+}
+
+// the same counts add_votes would have ended up with
+func (c *bit_counter) counts() (counts [64]int) {
+
+	c.flush()
+	for i, ones := range c.ones {
+		counts[i] = 2*ones - c.n
+	}
+
+	return
+}
+
+// bit i is set if more hashes had it set than not, same as simhash_from_counts
+func (c *bit_counter) simhash() (simhash uint64) {
+
+	c.flush()
+	for i, ones := range c.ones {
+		if 2*ones > c.n {
+			simhash |= 1 << uint(i)
+		}
+	}
+
+	return
+}
+
+// Same as SimHash, but for bytes. Doesn't allocate.
+func SimHashBytes(src []byte) uint64 {
+
+	var c bit_counter
+	shingle_votes(src, &c)
+	return c.simhash()
+}
+
+// Appends the simhash of src to dst, big endian like SimHasher.Sum. Doesn't allocate if dst
+// has room for it.
+func AppendSimHash(dst []byte, src []byte) []byte {
+
+	return append_hash(dst, SimHashBytes(src))
+}
+
+func append_hash(dst []byte, s uint64) []byte {
+	return append(dst, byte(s>>56), byte(s>>48), byte(s>>40), byte(s>>32), byte(s>>24), byte(s>>16), byte(s>>8), byte(s))
+}
@@ -0,0 +1,103 @@
+package simhashing
+
+import "testing"
+import "fmt"
+import "math/rand"
+import "strings"
+
+func TestSimHashFastPath(t *testing.T) {
+
+	r := rand.New(rand.NewSource(1618))
+
+	// lengths around where the lane counters get flushed
+	var texts []string
+	for _, n := range []int{0, 1, 2, 3, 4, 100, 255, 256, 257, 258, 511, 512, 2000} {
+		b := make([]byte, n)
+		r.Read(b)
+		texts = append(texts, string(b))
+	}
+	for i := 0; i < 100; i++ {
+		texts = append(texts, fmt.Sprintf("%016x", r.Int63()))
+	}
+
+	for _, text := range texts {
+		slow := token_counts(text, Strong64)
+		if fast := simhash_counts(text); fast != slow {
+			t.Errorf("Counts for a text of %d bytes differ", len(text))
+		}
+		expected := simhash_from_counts(&slow)
+		if SimHash(text) != expected || SimHashBytes([]byte(text)) != expected {
+			t.Errorf("Fast simhash of a text of %d bytes is wrong", len(text))
+		}
+	}
+
+	// the lane counts don't overflow on the same hash over and over
+	long := strings.Repeat("a", 10*1000)
+	slow := token_counts(long, Strong64)
+	if simhash_counts(long) != slow {
+		t.Error("Counts for a repeated shingle differ")
+	}
+}
+
+func TestSimHashBytesAllocs(t *testing.T) {
+
+	src := []byte("It was the best of times, it was the worst of times,")
+	dst := make([]byte, 0, 8)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		SimHashBytes(src)
+		dst = AppendSimHash(dst[:0], src)
+	})
+	if allocs != 0 {
+		t.Errorf("Expected no allocations, got %v", allocs)
+	}
+	if len(dst) != 8 || dst[7] != byte(SimHash(string(src))) {
+		t.Errorf("AppendSimHash appended %x", dst)
+	}
+}
+
+func benchmark_texts() [][]byte {
+
+	r := rand.New(rand.NewSource(45342))
+	texts := make([][]byte, 1000)
+	for i := range texts {
+		texts[i] = []byte(strings.Repeat(fmt.Sprintf("%016x", r.Int63()), 8))
+	}
+
+	return texts
+}
+
+// the way SimHash used to do it, to compare with
+func BenchmarkSimHashTokenize(b *testing.B) {
+
+	texts := benchmark_texts()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		counts := token_counts(string(texts[i%len(texts)]), Strong64)
+		simhash_from_counts(&counts)
+	}
+}
+
+func BenchmarkSimHashBytes(b *testing.B) {
+
+	texts := benchmark_texts()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		SimHashBytes(texts[i%len(texts)])
+	}
+}
+
+// BenchmarkInsert, without the string
+func BenchmarkInsertBytes(b *testing.B) {
+
+	simstore := NewSimStore()
+	r := rand.New(rand.NewSource(45342))
+	text := make([]byte, 16)
+
+	for i := 0; i < b.N; i++ {
+		r.Read(text)
+		simstore.InsertHash(SimHashBytes(text), int64(i))
+	}
+}
@@ -0,0 +1,60 @@
+package simhashing
+
+import "go/scanner"
+import "go/token"
+import "strings"
+
+// Go source: copy-pasted code usually gets its variables renamed, comments changed and
+// gofmt run over it, and 3-grams of bytes see all of that. The "gosource" tokenizer lexes
+// the code and shingles what kind of tokens there are instead.
+
+// how many Go tokens go in a shingle
+const go_shingle_length = 5
+
+func init() {
+	tokenizers["gosource"] = func(text string, emit func(string, int)) {
+		tokens := GoTokens(text)
+		if len(tokens) > 0 && len(tokens) < go_shingle_length {
+			emit(strings.Join(tokens, " "), 1)
+			return
+		}
+		for i := 0; i+go_shingle_length <= len(tokens); i++ {
+			emit(strings.Join(tokens[i:i+go_shingle_length], " "), 1)
+		}
+	}
+
+	if err := RegisterAlgorithm(Algorithm{ID: "simhash64-gosource-strong64-uniform-v1", Tokenizer: "gosource", TokenHash: "strong64", Weighting: "uniform", Width: 64}); err != nil {
+		panic(err)
+	}
+}
+
+// Returns the tokens of Go source code with every identifier replaced by "IDENT" and every
+// literal by its kind ("INT", "STRING", ..). Keywords and operators stay what they are,
+// comments are dropped and so is the layout, except for where statements end.
+// It doesn't have to be a complete file, anything that lexes goes and errors are skipped.
+func GoTokens(src string) (tokens []string) {
+
+	b := []byte(src)
+	file := token.NewFileSet().AddFile("", -1, len(b))
+
+	var s scanner.Scanner
+	s.Init(file, b, nil, 0) // no scanner.ScanComments, so no comments
+
+	for {
+		// we never look at the literal, so identifiers come out as "IDENT", numbers as "INT" and
+		// so on, and the semicolons go inserts at the end of a line are the same as typed ones
+		_, tok, _ := s.Scan()
+		switch tok {
+		case token.EOF:
+			return
+		case token.ILLEGAL:
+			continue
+		case token.RPAREN, token.RBRACE:
+			// "return x }" on one line has no semicolon, gofmt'd it does
+			if n := len(tokens); n > 0 && tokens[n-1] == ";" {
+				tokens = tokens[:n-1]
+			}
+		}
+		tokens = append(tokens, tok.String())
+	}
+}
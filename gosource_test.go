@@ -0,0 +1,93 @@
+package simhashing
+
+import "testing"
+import "reflect"
+
+const go_original = `package main
+
+import "fmt"
+
+// Sum adds up all the numbers
+func Sum(numbers []int) int {
+	total := 0
+	for _, n := range numbers {
+		total += n
+	}
+	return total
+}
+
+func main() {
+	fmt.Println(Sum([]int{1, 2, 3}), "done")
+}
+`
+
+// renamed, recommented, reformatted and with other literals
+const go_copy = `package main
+import "fmt"
+/* adds things */
+func Add(xs []int) int { acc := 100; for _, x := range xs {
+		acc += x // keep going
+	}
+	return acc }
+
+func main() { fmt.Println(Add([]int{4, 5, 6}), "finished") }
+`
+
+const go_other = `package main
+
+type server struct {
+	mu    sync.Mutex
+	conns map[string]net.Conn
+}
+
+func (s *server) close(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.conns[name]; ok {
+		delete(s.conns, name)
+		return c.Close()
+	}
+	return nil
+}
+`
+
+func TestGoTokens(t *testing.T) {
+
+	expected := []string{"IDENT", ":=", "INT", ";", "IDENT", ".", "IDENT", "(", "STRING", ")", ";"}
+	if tokens := GoTokens("x := 42 // the answer\nfmt.Print(`hi`)\n"); !reflect.DeepEqual(tokens, expected) {
+		t.Errorf("Expected %v, got %v", expected, tokens)
+	}
+
+	if !reflect.DeepEqual(GoTokens(go_original), GoTokens(go_copy)) {
+		t.Errorf("Renaming and reformatting changed the tokens:\n%v\n%v", GoTokens(go_original), GoTokens(go_copy))
+	}
+
+	// not Go at all still gives something
+	if len(GoTokens("#!@ hello")) == 0 {
+		t.Error("Expected some tokens for junk")
+	}
+}
+
+func TestGoSourceAlgorithm(t *testing.T) {
+
+	a, ok := LookupAlgorithm("simhash64-gosource-strong64-uniform-v1")
+	if !ok {
+		t.Fatal("gosource algorithm isn't registered")
+	}
+
+	if a.Hash(go_original) != a.Hash(go_copy) {
+		t.Error("The copy should have the same fingerprint")
+	}
+	if d := hamming_distance(SimHash(go_original), SimHash(go_copy)); d < 4 {
+		t.Errorf("Expected the plain SimHash to see the edits, distance is %d", d)
+	}
+	if d := hamming_distance(a.Hash(go_original), a.Hash(go_other)); d < 12 {
+		t.Errorf("Different code is only %d bits away", d)
+	}
+
+	// a copy with an extra statement is still close
+	edited := go_copy[:len(go_copy)-2] + "; fmt.Println(\"bye\") }\n"
+	if d := hamming_distance(a.Hash(go_original), a.Hash(edited)); d > 10 {
+		t.Errorf("A small edit moved %d bits", d)
+	}
+}
@@ -1,36 +1,45 @@
 package simhashing
 
+// Magic number 3: SimHash hashes overlapping shingles of this many bytes
+const shingle_length = 3
+
 // Generate a 64 bit simhash for a string
 func SimHash(src string) uint64 {
 
-	// Magic number 3, as well as a tokenize function
-	tokens := Tokenize_stride(src, 3)
+	var c bit_counter
+	shingle_votes(src, &c)
+	return c.simhash()
+}
 
-	var counts [64]int
+// every token votes on every bit: +1 if its hash has that bit set, -1 if not
+func simhash_counts(src string) [64]int {
 
-	for _, token := range tokens {
-		h := Strong64(token) // Could pick any hashing function
-
-		for i := uint8(0); i < 64; i++ {
-			if h&(1<<i) > 0 {
-				counts[i]++
-			} else {
-				counts[i]--
-			}
-		}
+	var c bit_counter
+	shingle_votes(src, &c)
+	return c.counts()
+}
+
+func token_counts(src string, h TokenHash) (counts [64]int) {
 
+	tokens := Tokenize_stride(src, shingle_length)
+
+	for _, token := range tokens {
+		add_votes(&counts, h(token))
 	}
 
-	// simhash bit i is 1 if counts[i] > 0 and 0 otherwise
+	return
+}
+
+// simhash bit i is 1 if counts[i] > 0 and 0 otherwise
+func simhash_from_counts(counts *[64]int) (simhash uint64) {
 
-	var simhash uint64
 	for i := uint8(0); i < 64; i++ {
 		if counts[i] > 0 {
 			simhash |= 1 << i
 		}
 	}
 
-	return simhash
+	return
 }
 
 // Calculate a basic hash code for a string
@@ -47,17 +56,19 @@ func Basic64(in string) uint64 {
 
 // Strong 64 bit hash for a string.
 // references: http://www.javamex.com/tutorials/collections/strong_hash_code.shtml
+//
+// The Java original mixes in a rotated char as a second step, but a uint8 shifted by 8 or more
+// is always 0 in Go, so the second step always mixes in byteTable[0]. That's what it has always
+// done here, and changing it would change every fingerprint, so it stays (see the other token
+// hashes in tokenhash.go for better mixed ones).
 func Strong64(in string) uint64 {
 
 	h := _HSTART
-	var ch uint8
 	num_bytes := len(in)
 
 	for i := 0; i < num_bytes; i++ {
-		ch = in[i]
-		h = (h * _HMULT) ^ byteTable[ch&0xff]
-		ch_ror_64 := (ch >> 8) | (ch << (64*8 - 8))
-		h = (h * _HMULT) ^ byteTable[ch_ror_64&0xff]
+		h = (h * _HMULT) ^ byteTable[in[i]]
+		h = (h * _HMULT) ^ byteTable[0] // was the degenerate ch_ror_64, see above
 	}
 
 	return h
@@ -74,12 +85,17 @@ func init() {
 	var h uint64 = 0x544B2FBACAAF1684
 
 	for i := 0; i < 256; i++ {
+		// the original also ORs in h << (64*8 - 7) and h << (64*8 - 10),
+		// but shifting a uint64 by that much is always 0
 		for j := 0; j < 31; j++ {
-			h = (h >> 10) | (h << (64*8 - 7)) ^ h
+			h = (h >> 10) ^ h
 			h = (h << 11) ^ h
-			h = (h >> 10) | (h << (64*8 - 10)) ^ h
+			h = (h >> 10) ^ h
 		}
 		byteTable[i] = h
 	}
 
+	for i := 0; i < 256; i++ {
+		strong64_first[i] = strong64_step(_HSTART, uint8(i))
+	}
 }
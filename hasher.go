@@ -0,0 +1,84 @@
+package simhashing
+
+import "hash"
+import "io"
+
+// SimHash needs the whole text in memory. A SimHasher gets the text in pieces, keeps the
+// last 2 bytes around so shingles that straddle two Writes still count, and never holds on
+// to more than that. It gives exactly the same fingerprint as SimHash of all the bytes written.
+type SimHasher struct {
+	votes bit_counter
+	tail  [shingle_length - 1]byte // the last bytes written, the start of the next shingle
+	n     int                      // bytes written so far
+}
+
+var _ hash.Hash64 = (*SimHasher)(nil)
+
+// Creates a SimHasher that hashes like SimHash
+func NewSimHasher() *SimHasher {
+	return &SimHasher{}
+}
+
+// Adds p to the text. Never fails.
+func (h *SimHasher) Write(p []byte) (int, error) {
+
+	for _, b := range p {
+		if h.n >= len(h.tail) {
+			h.votes.add(strong64_shingle(h.tail[0], h.tail[1], b))
+		}
+		h.tail[0], h.tail[1] = h.tail[1], b
+		h.n++
+	}
+
+	return len(p), nil
+}
+
+// Same as Write
+func (h *SimHasher) WriteString(s string) (int, error) {
+	return h.Write([]byte(s))
+}
+
+// Returns the simhash of everything written so far. Doesn't change anything, so you can
+// keep writing after.
+func (h *SimHasher) Sum64() uint64 {
+
+	// texts shorter than a shingle are one token on their own, like in Tokenize_stride
+	if h.n < shingle_length {
+		var c bit_counter
+		shingle_votes(h.tail[len(h.tail)-h.n:], &c)
+		return c.simhash()
+	}
+
+	return h.votes.simhash()
+}
+
+// Appends the simhash to b, big endian like hash/fnv does
+func (h *SimHasher) Sum(b []byte) []byte {
+	return append_hash(b, h.Sum64())
+}
+
+// Forgets everything written so far
+func (h *SimHasher) Reset() {
+	*h = SimHasher{}
+}
+
+// 8 bytes
+func (h *SimHasher) Size() int {
+	return 8
+}
+
+// Any size works, but a shingle is the smallest thing we hash
+func (h *SimHasher) BlockSize() int {
+	return shingle_length
+}
+
+// Returns the simhash of everything read from r, without reading it all into memory first
+func SimHashReader(r io.Reader) (uint64, error) {
+
+	h := NewSimHasher()
+	if _, err := io.Copy(h, r); err != nil {
+		return 0, err
+	}
+
+	return h.Sum64(), nil
+}
@@ -0,0 +1,79 @@
+package simhashing
+
+import "testing"
+import "encoding/binary"
+import "fmt"
+import "math/rand"
+import "strings"
+
+func TestSimHasher(t *testing.T) {
+
+	r := rand.New(rand.NewSource(2718))
+
+	texts := []string{"", "a", "ab", "abc", "abcd", "It was the best of times, it was the worst of times,"}
+	for i := 0; i < 50; i++ {
+		texts = append(texts, strings.Repeat(fmt.Sprintf("%016x", r.Int63()), 1+r.Intn(20)))
+	}
+
+	for _, text := range texts {
+		expected := SimHash(text)
+
+		// write it in random pieces, including empty ones
+		h := NewSimHasher()
+		rest := text
+		for len(rest) > 0 {
+			n := r.Intn(5)
+			if n > len(rest) {
+				n = len(rest)
+			}
+			h.Write([]byte(rest[:n]))
+			rest = rest[n:]
+		}
+		if got := h.Sum64(); got != expected {
+			t.Errorf("SimHasher(%q) = %016x, SimHash says %016x", text, got, expected)
+		}
+
+		got, err := SimHashReader(strings.NewReader(text))
+		if err != nil || got != expected {
+			t.Errorf("SimHashReader(%q) = %016x, %v", text, got, err)
+		}
+	}
+
+	// Sum64 doesn't stop us from writing more
+	h := NewSimHasher()
+	h.WriteString("It was the best")
+	if h.Sum64() != SimHash("It was the best") {
+		t.Error("Sum64 halfway is wrong")
+	}
+	h.WriteString(" of times")
+	if h.Sum64() != SimHash("It was the best of times") {
+		t.Error("Sum64 after writing more is wrong")
+	}
+
+	sum := h.Sum([]byte{0xff})
+	if len(sum) != 9 || sum[0] != 0xff || binary.BigEndian.Uint64(sum[1:]) != h.Sum64() {
+		t.Errorf("Sum appended %x", sum)
+	}
+
+	h.Reset()
+	if h.Sum64() != SimHash("") {
+		t.Error("Reset didn't reset")
+	}
+}
+
+func BenchmarkSimHashReader(b *testing.B) {
+
+	r := rand.New(rand.NewSource(2718))
+	var text strings.Builder
+	for text.Len() < 1<<20 {
+		fmt.Fprintf(&text, "%016x ", r.Int63())
+	}
+	src := text.String()
+
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		SimHashReader(strings.NewReader(src))
+	}
+}
@@ -0,0 +1,142 @@
+package simhashing
+
+import "strings"
+import "golang.org/x/net/html"
+import "golang.org/x/net/html/atom"
+
+// Web pages: most of the 3-grams of a raw page are markup, scripts and navigation that
+// every page on a site shares, so two unrelated articles look like near-duplicates.
+// The "html" tokenizer only shingles the text a reader would see.
+
+// A run of visible text from a page and how many votes its shingles get
+type TextBlock struct {
+	Text   string
+	Weight int
+}
+
+// everything inside these is skipped
+var html_skipped = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Noscript: true,
+	atom.Template: true,
+	atom.Svg:      true,
+	atom.Iframe:   true,
+	atom.Object:   true,
+	atom.Nav:      true,
+}
+
+// text inside these says more about what the page is about (with the "weighted" weighting)
+var html_weights = map[atom.Atom]int{
+	atom.Title: 3,
+	atom.H1:    3,
+	atom.H2:    2,
+	atom.H3:    2,
+}
+
+// these don't start a new block of text, every other tag does
+var html_inline = map[atom.Atom]bool{
+	atom.A: true, atom.Abbr: true, atom.B: true, atom.Bdi: true, atom.Bdo: true, atom.Cite: true,
+	atom.Code: true, atom.Data: true, atom.Dfn: true, atom.Em: true, atom.Font: true, atom.I: true,
+	atom.Kbd: true, atom.Mark: true, atom.Q: true, atom.S: true, atom.Samp: true, atom.Small: true,
+	atom.Span: true, atom.Strong: true, atom.Sub: true, atom.Sup: true, atom.Time: true, atom.U: true,
+	atom.Var: true, atom.Wbr: true,
+}
+
+func init() {
+	tokenizers["html"] = func(text string, emit func(string, int)) {
+		for _, block := range ExtractHTML(text) {
+			for _, token := range Tokenize_stride(block.Text, shingle_length) {
+				emit(token, block.Weight)
+			}
+		}
+	}
+
+	for _, a := range []Algorithm{
+		{ID: "simhash64-html-strong64-uniform-v1", Tokenizer: "html", TokenHash: "strong64", Weighting: "uniform", Width: 64},
+		{ID: "simhash64-html-strong64-weighted-v1", Tokenizer: "html", TokenHash: "strong64", Weighting: "weighted", Width: 64},
+	} {
+		if err := RegisterAlgorithm(a); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Returns the visible text of an HTML page as blocks (paragraphs, headings, list items..)
+// with whitespace collapsed and entities decoded. Scripts, styles and navigation are left out,
+// and the title and headings weigh more than the rest. Broken markup is fine, we only look
+// at the tags one at a time and never build a tree.
+func ExtractHTML(src string) (blocks []TextBlock) {
+
+	z := html.NewTokenizer(strings.NewReader(src))
+
+	skipping := 0                   // how many skipped elements we're in
+	open := make(map[atom.Atom]int) // how many of each weighted element we're in
+	var text strings.Builder
+
+	flush := func() {
+		t := strings.Join(strings.Fields(text.String()), " ")
+		text.Reset()
+		if t == "" {
+			return
+		}
+		weight := 1
+		for a, n := range open {
+			if n > 0 && html_weights[a] > weight {
+				weight = html_weights[a]
+			}
+		}
+		blocks = append(blocks, TextBlock{Text: t, Weight: weight})
+	}
+
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			// io.EOF or a read error, and reading a string doesn't fail
+			flush()
+			return
+
+		case html.TextToken:
+			if skipping == 0 {
+				text.Write(z.Text())
+			}
+
+		case html.StartTagToken, html.EndTagToken:
+			name, _ := z.TagName()
+			a := atom.Lookup(name)
+			if html_inline[a] {
+				continue
+			}
+			flush()
+
+			delta := 1
+			if tt == html.EndTagToken {
+				delta = -1
+			}
+			if html_skipped[a] && skipping+delta >= 0 {
+				skipping += delta
+			}
+			if html_weights[a] > 0 && open[a]+delta >= 0 {
+				open[a] += delta
+			}
+
+		case html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			if !html_inline[atom.Lookup(name)] {
+				flush()
+			}
+		}
+	}
+}
+
+// Returns the visible text of an HTML page, one block per line
+func HTMLText(src string) string {
+
+	var lines []string
+	for _, block := range ExtractHTML(src) {
+		lines = append(lines, block.Text)
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,77 @@
+package simhashing
+
+import "testing"
+import "fmt"
+import "reflect"
+
+const page = `<!DOCTYPE html>
+<html><head>
+<title>Best of times</title>
+<style>body { font-family: serif }</style>
+<script>var tracking = "It was the best of times";</script>
+</head><body>
+<nav><ul><li><a href="/">Home</a></li><li><a href="/about">About</a></li></ul></nav>
+<h1>A Tale of Two Cities</h1>
+<p>It was the <b>best</b> of times,
+   it was the worst of times &amp; so on.</p>
+<noscript>Turn on JavaScript</noscript>
+<p>It was the age of wisdom<br>it was the age of foolishness</p>
+</body></html>`
+
+func TestExtractHTML(t *testing.T) {
+
+	expected := []TextBlock{
+		{"Best of times", 3},
+		{"A Tale of Two Cities", 3},
+		{"It was the best of times, it was the worst of times & so on.", 1},
+		{"It was the age of wisdom", 1},
+		{"it was the age of foolishness", 1},
+	}
+	if blocks := ExtractHTML(page); !reflect.DeepEqual(blocks, expected) {
+		t.Errorf("Expected %v, got %v", expected, blocks)
+	}
+
+	// broken markup: unclosed tags and stray end tags
+	blocks := ExtractHTML(`<p>one <script>two</p><p>three</script></style> four<h2>five`)
+	expected = []TextBlock{{"one", 1}, {"four", 1}, {"five", 2}}
+	if !reflect.DeepEqual(blocks, expected) {
+		t.Errorf("Expected %v, got %v", expected, blocks)
+	}
+
+	if text := HTMLText("<p>a</p><p>b</p>"); text != "a\nb" {
+		t.Errorf("HTMLText returned %q", text)
+	}
+}
+
+func TestHTMLAlgorithm(t *testing.T) {
+
+	uniform, _ := LookupAlgorithm("simhash64-html-strong64-uniform-v1")
+	weighted, _ := LookupAlgorithm("simhash64-html-strong64-weighted-v1")
+
+	article := "<h1>A Tale of Two Cities</h1><p>It was the best of times, it was the worst of times.</p>"
+	page_a := "<html><head><script>track('a')</script></head><body><nav>Home | News | Sports</nav>" + article + "</body></html>"
+	page_b := `<html><body class="x"><nav><a href="/">Start</a> <a href="/weather">Weather</a></nav>` + article + "<style>p{}</style></body></html>"
+	if uniform.Hash(page_a) != uniform.Hash(page_b) || weighted.Hash(page_a) != weighted.Hash(page_b) {
+		t.Error("Pages with the same text should have the same fingerprint")
+	}
+	if SimHash(page_a) == SimHash(page_b) {
+		t.Error("Expected the raw pages to differ")
+	}
+	if uniform.Hash(article) == weighted.Hash(article) {
+		t.Error("The heading should change the weighted fingerprint")
+	}
+
+	// a store for pages finds the same article under different chrome
+	simstore, err := NewSimStoreWithAlgorithm(weighted.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		simstore.Insert(fmt.Sprintf("<nav>%d</nav><h1>Article %d</h1><p>Text of article %d</p>", i, i, i*7919), int64(i))
+	}
+	simstore.Insert(page_a, -1)
+	found, _, _ := simstore.Find(page_b, 0)
+	if len(found) != 1 || found[0] != -1 {
+		t.Errorf("Expected to find page_a, got %v", found)
+	}
+}
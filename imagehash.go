@@ -0,0 +1,194 @@
+package simhashing
+
+import "image"
+import "io"
+import "math"
+import "sort"
+import _ "image/gif"
+import _ "image/jpeg"
+import _ "image/png"
+
+// Perceptual image hashes: like a simhash, images that look alike get hashes that are a
+// small Hamming distance apart, so a SimStore can index them all the same. They all shrink
+// the image to a few grey pixels first, which throws away size, aspect ratio, compression
+// noise and most colour changes. Bit i of a hash is pixel (or coefficient) i in row order.
+
+// Hashes an image into 64 bits
+type ImageHash func(img image.Image) uint64
+
+// Average hash: every pixel of an 8x8 thumbnail that's brighter than the average.
+// Quick, but a gamma or contrast change moves a lot of bits.
+func AHash(img image.Image) (hash uint64) {
+
+	pixels := grey_thumbnail(img, 8, 8)
+
+	mean := 0.0
+	for _, p := range pixels {
+		mean += p
+	}
+	mean /= float64(len(pixels))
+
+	for i, p := range pixels {
+		if p > mean {
+			hash |= 1 << uint(i)
+		}
+	}
+
+	return
+}
+
+// Difference hash: in a 9x8 thumbnail, every pixel that's darker than the one to its right.
+// Only looks at gradients, so brightness and contrast changes don't matter.
+func DHash(img image.Image) (hash uint64) {
+
+	pixels := grey_thumbnail(img, 9, 8)
+
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if pixels[y*9+x] < pixels[y*9+x+1] {
+				hash |= 1 << uint(y*8+x)
+			}
+		}
+	}
+
+	return
+}
+
+// Perceptual hash: the 8x8 lowest frequencies of the DCT of a 32x32 thumbnail, every one
+// that's above the median. The most robust of the three, and the slowest.
+func PHash(img image.Image) (hash uint64) {
+
+	const n = 32
+	pixels := grey_thumbnail(img, n, n)
+
+	// a 2D DCT-II is a DCT of every row and then of every column, and we only want the first 8 of each
+	var rows [n][8]float64
+	for y := 0; y < n; y++ {
+		for u := 0; u < 8; u++ {
+			for x := 0; x < n; x++ {
+				rows[y][u] += pixels[y*n+x] * dct_cos[u][x]
+			}
+		}
+	}
+	var coefficients [64]float64
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			for y := 0; y < n; y++ {
+				coefficients[v*8+u] += rows[y][u] * dct_cos[v][y]
+			}
+		}
+	}
+
+	sorted := coefficients
+	sort.Float64s(sorted[:])
+	median := (sorted[31] + sorted[32]) / 2
+
+	for i, c := range coefficients {
+		if c > median {
+			hash |= 1 << uint(i)
+		}
+	}
+
+	return
+}
+
+// dct_cos[u][x] = cos((2x+1)uπ/64), for the 32 point DCT
+var dct_cos [8][32]float64
+
+func init() {
+	for u := range dct_cos {
+		for x := range dct_cos[u] {
+			dct_cos[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / 64)
+		}
+	}
+}
+
+// Shrinks img to w x h grey pixels (row by row, 0 to 65535) by averaging all pixels that
+// end up in the same spot. Images smaller than that get their pixels repeated.
+func grey_thumbnail(img image.Image, w, h int) []float64 {
+
+	bounds := img.Bounds()
+	src_w, src_h := bounds.Dx(), bounds.Dy()
+	pixels := make([]float64, w*h)
+	if src_w == 0 || src_h == 0 {
+		return pixels
+	}
+
+	grey := grey_pixels(img)
+
+	// which source rows/columns go in thumbnail row/column i
+	span := func(i, n, src int) (int, int) {
+		from, to := i*src/n, (i+1)*src/n
+		if to <= from {
+			to = from + 1
+		}
+		return from, to
+	}
+
+	for ty := 0; ty < h; ty++ {
+		y0, y1 := span(ty, h, src_h)
+		for tx := 0; tx < w; tx++ {
+			x0, x1 := span(tx, w, src_w)
+
+			sum := 0.0
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					sum += grey(bounds.Min.X+x, bounds.Min.Y+y)
+				}
+			}
+			pixels[ty*w+tx] = sum / float64((y1-y0)*(x1-x0))
+		}
+	}
+
+	return pixels
+}
+
+// Returns how grey every pixel of img is (0 to 65535). img.At allocates a color for every
+// pixel, so the types the decoders give us are read directly.
+func grey_pixels(img image.Image) func(x, y int) float64 {
+
+	switch img := img.(type) {
+	case *image.YCbCr: // JPEG: Y already is the grey
+		return func(x, y int) float64 {
+			return float64(img.Y[img.YOffset(x, y)]) * 257
+		}
+	case *image.Gray:
+		return func(x, y int) float64 {
+			return float64(img.Pix[img.PixOffset(x, y)]) * 257
+		}
+	case *image.RGBA:
+		return func(x, y int) float64 {
+			i := img.PixOffset(x, y)
+			r, g, b := uint32(img.Pix[i])*257, uint32(img.Pix[i+1])*257, uint32(img.Pix[i+2])*257
+			return float64(19595*r+38470*g+7471*b) / 65536
+		}
+	}
+
+	return func(x, y int) float64 {
+		r, g, b, _ := img.At(x, y).RGBA()
+		return float64(19595*r+38470*g+7471*b) / 65536 // the same weights as color.GrayModel
+	}
+}
+
+// Decodes a PNG, JPEG or GIF from r and hashes it with h
+func HashImage(r io.Reader, h ImageHash) (uint64, error) {
+
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return 0, err
+	}
+
+	return h(img), nil
+}
+
+// Inserts an image, hashed with h. Use the same h for everything in a store (and don't
+// mix images and text), hashes from different functions can't be compared.
+func (s *SimStore) InsertImage(img image.Image, h ImageHash, id int64) {
+	s.InsertHash(h(img), id)
+}
+
+// Finds all images within distance of img, which has to be hashed with the same h as the
+// images in the store.
+func (s *SimStore) FindImage(img image.Image, h ImageHash, distance uint8) (found []int64, keys_checked int, nodes_checked int) {
+	return s.FindHash(h(img), distance)
+}
@@ -0,0 +1,223 @@
+package simhashing
+
+import "testing"
+import "bytes"
+import "image"
+import "image/color"
+import "image/gif"
+import "image/jpeg"
+import "image/png"
+import "math/rand"
+
+// a gradient with some random rectangles and circles on it
+func random_image(r *rand.Rand, w, h int) *image.RGBA {
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	from, to := r.Intn(256), r.Intn(256)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8(from + (to-from)*x/w)
+			img.Set(x, y, color.RGBA{v, v, uint8(y * 255 / h), 255})
+		}
+	}
+
+	for shapes := 0; shapes < 6; shapes++ {
+		c := color.RGBA{uint8(r.Intn(256)), uint8(r.Intn(256)), uint8(r.Intn(256)), 255}
+		cx, cy, size := r.Intn(w), r.Intn(h), w/8+r.Intn(w/4)
+		circle := r.Intn(2) == 0
+		for y := cy - size; y < cy+size; y++ {
+			for x := cx - size; x < cx+size; x++ {
+				if circle && (x-cx)*(x-cx)+(y-cy)*(y-cy) > size*size {
+					continue
+				}
+				if image.Pt(x, y).In(img.Bounds()) {
+					img.Set(x, y, c)
+				}
+			}
+		}
+	}
+
+	return img
+}
+
+// nearest neighbour resize
+func resized(img image.Image, w, h int) *image.RGBA {
+
+	b := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			out.Set(x, y, img.At(b.Min.X+x*b.Dx()/w, b.Min.Y+y*b.Dy()/h))
+		}
+	}
+
+	return out
+}
+
+func brightened(img *image.RGBA, delta int) *image.RGBA {
+
+	out := image.NewRGBA(img.Bounds())
+	for i, v := range img.Pix {
+		if i%4 == 3 {
+			out.Pix[i] = v
+			continue
+		}
+		n := int(v) + delta
+		if n > 255 {
+			n = 255
+		}
+		out.Pix[i] = uint8(n)
+	}
+
+	return out
+}
+
+var image_hashes = map[string]ImageHash{"aHash": AHash, "dHash": DHash, "pHash": PHash}
+
+func TestImageHashes(t *testing.T) {
+
+	r := rand.New(rand.NewSource(2718))
+
+	originals := make([]*image.RGBA, 20)
+	for i := range originals {
+		originals[i] = random_image(r, 256, 192)
+	}
+
+	for name, h := range image_hashes {
+		far := 0
+		for i, img := range originals {
+			hash := h(img)
+
+			var jpg bytes.Buffer
+			jpeg.Encode(&jpg, img, &jpeg.Options{Quality: 60})
+			from_jpeg, err := HashImage(&jpg, h)
+			if err != nil {
+				t.Fatalf("%s: HashImage of a JPEG: %v", name, err)
+			}
+
+			changed := map[string]uint64{
+				"half size":    h(resized(img, 128, 96)),
+				"stretched":    h(resized(img, 400, 192)),
+				"brighter":     h(brightened(img, 20)),
+				"JPEG":         from_jpeg,
+				"cropped a px": h(img.SubImage(image.Rect(1, 1, 255, 191))),
+			}
+			for what, other := range changed {
+				if d := hamming_distance(hash, other); d > 8 {
+					t.Errorf("%s of image %d %s is %d bits off", name, i, what, d)
+				}
+			}
+
+			for j := i + 1; j < len(originals); j++ {
+				if hamming_distance(hash, h(originals[j])) > 12 {
+					far++
+				}
+			}
+		}
+		// different images: nearly all should be well apart
+		if pairs := len(originals) * (len(originals) - 1) / 2; far < pairs*9/10 {
+			t.Errorf("%s: only %d of %d pairs of different images are more than 12 bits apart", name, far, pairs)
+		}
+	}
+}
+
+func TestImageHashEdgeCases(t *testing.T) {
+
+	// a flat image has nothing above the mean or to the right
+	flat := image.NewGray(image.Rect(0, 0, 50, 50))
+	if AHash(flat) != 0 || DHash(flat) != 0 {
+		t.Errorf("flat image hashes to %016x %016x", AHash(flat), DHash(flat))
+	}
+
+	// smaller than the thumbnails, and empty
+	tiny := random_image(rand.New(rand.NewSource(1)), 4, 4)
+	for name, h := range image_hashes {
+		h(tiny)
+		if hash := h(image.NewRGBA(image.Rect(0, 0, 0, 0))); hash != 0 {
+			t.Errorf("%s of an empty image = %016x", name, hash)
+		}
+	}
+
+	// the right half white: column 4 (of 9) is half white, so dHash steps up at columns 3 and 4
+	half := image.NewGray(image.Rect(0, 0, 90, 80))
+	for y := 0; y < 80; y++ {
+		for x := 45; x < 90; x++ {
+			half.SetGray(x, y, color.Gray{255})
+		}
+	}
+	if hash := DHash(half); hash != 0x1818181818181818 {
+		t.Errorf("DHash of a half white image = %016x", hash)
+	}
+	if hash := AHash(half); hash != 0xf0f0f0f0f0f0f0f0 {
+		t.Errorf("AHash of a half white image = %016x", hash)
+	}
+
+	if _, err := HashImage(bytes.NewReader([]byte("not an image")), PHash); err == nil {
+		t.Error("HashImage of garbage didn't fail")
+	}
+}
+
+func TestFindImage(t *testing.T) {
+
+	r := rand.New(rand.NewSource(2718))
+	s := NewSimStore()
+
+	var images []*image.RGBA
+	for i := 0; i < 200; i++ {
+		img := random_image(r, 64+r.Intn(64), 64+r.Intn(64))
+		images = append(images, img)
+		s.InsertImage(img, PHash, int64(i))
+	}
+
+	for _, i := range []int{0, 17, 123, 199} {
+		// through PNG and GIF, and a different size
+		var buf bytes.Buffer
+		if i%2 == 0 {
+			png.Encode(&buf, resized(images[i], 200, 150))
+		} else {
+			gif.Encode(&buf, images[i], nil)
+		}
+		decoded, _, err := image.Decode(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		found, _, _ := s.FindImage(decoded, PHash, 8)
+		hit := false
+		for _, id := range found {
+			hit = hit || id == int64(i)
+		}
+		if !hit || len(found) > 3 {
+			t.Errorf("FindImage of image %d found %v", i, found)
+		}
+	}
+}
+
+func TestInsertIdenticalImages(t *testing.T) {
+
+	// blank images all hash to 0, and collections have lots of exact duplicates anyway
+	s := NewSimStore()
+	blank := image.NewGray(image.Rect(0, 0, 32, 32))
+	for i := 0; i < 300; i++ {
+		s.InsertImage(blank, AHash, int64(i))
+	}
+	other := random_image(rand.New(rand.NewSource(2718)), 64, 64)
+	s.InsertImage(other, AHash, 300)
+
+	if found, _, _ := s.FindImage(blank, AHash, 0); len(found) != 300 {
+		t.Errorf("found %d of the 300 identical images", len(found))
+	}
+	if found, _, _ := s.FindImage(other, AHash, 0); len(found) != 1 || found[0] != 300 {
+		t.Errorf("FindImage of the other image found %v", found)
+	}
+}
+
+func BenchmarkPHash(b *testing.B) {
+
+	img := random_image(rand.New(rand.NewSource(2718)), 640, 480)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		PHash(img)
+	}
+}
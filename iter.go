@@ -0,0 +1,64 @@
+package simhashing
+
+import "iter"
+
+// Iterates over every (hash, id) pair in the store, in no particular order.
+// The store must not be changed while iterating.
+//
+//	for hash, id := range store.All() {
+//		...
+//	}
+func (s *SimStore) All() iter.Seq2[uint64, int64] {
+	return func(yield func(uint64, int64) bool) {
+		s.each(0, 0, yield)
+	}
+}
+
+// Iterates over the (hash, id) pairs whose lowest length bits are equal to those of prefix.
+// The trie splits on the lowest bytes first, so this only visits the subtree(s) for that prefix.
+func (s *SimStore) InRange(prefix uint64, length uint8) iter.Seq2[uint64, int64] {
+
+	if length > 64 {
+		length = 64
+	}
+	mask := ^uint64(0)
+	if length < 64 {
+		mask = (1 << length) - 1
+	}
+	prefix &= mask
+
+	return func(yield func(uint64, int64) bool) {
+
+		// go down as long as the prefix covers the whole byte for the level
+		node := s
+		for len(node.nodes) > 0 && uint(node.level+1)*bits_per_key <= uint(length) {
+			b := uint8((level_chunks[node.level] & prefix) >> (node.level * bits_per_key)) // this gets you the Nth byte
+			subtree, exists := node.nodes[b]
+			if !exists {
+				return
+			}
+			node = subtree
+		}
+
+		// whatever is left of the prefix we check for every key
+		node.each(prefix, mask, yield)
+	}
+}
+
+// yields every item with key&mask == prefix, returns false if yield asked us to stop
+func (s *SimStore) each(prefix uint64, mask uint64, yield func(uint64, int64) bool) bool {
+
+	for _, subtree := range s.nodes {
+		if !subtree.each(prefix, mask, yield) {
+			return false
+		}
+	}
+
+	for _, item := range s.values {
+		if item.key&mask == prefix && !yield(item.key, item.id) {
+			return false
+		}
+	}
+
+	return true
+}
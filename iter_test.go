@@ -0,0 +1,89 @@
+package simhashing
+
+import "testing"
+import "fmt"
+import "math/rand"
+
+func TestAll(t *testing.T) {
+
+	simstore := NewSimStore()
+
+	r := rand.New(rand.NewSource(6502))
+	expected := make(map[int64]uint64)
+	for i := 0; i < 3*1000; i++ {
+		text := fmt.Sprintf("%016x", r.Int63())
+		simstore.Insert(text, int64(i))
+		expected[int64(i)] = SimHash(text)
+	}
+
+	seen := 0
+	for hash, id := range simstore.All() {
+		if expected[id] != hash {
+			t.Errorf("Id %d has hash %016x, expected %016x", id, hash, expected[id])
+		}
+		seen++
+	}
+	if seen != len(expected) {
+		t.Errorf("All returned %d items, expected %d", seen, len(expected))
+	}
+
+	// stopping early
+	seen = 0
+	for range simstore.All() {
+		seen++
+		if seen == 10 {
+			break
+		}
+	}
+	if seen != 10 {
+		t.Errorf("Breaking out of All didn't work")
+	}
+
+	// re-indexing into another store
+	other := NewSimStore()
+	for hash, id := range simstore.All() {
+		other.InsertHash(hash, id)
+	}
+	keys, _ := other.Stats()
+	if keys != len(expected) {
+		t.Errorf("Re-indexed store has %d keys", keys)
+	}
+}
+
+func TestInRange(t *testing.T) {
+
+	simstore := NewSimStore()
+
+	r := rand.New(rand.NewSource(6809))
+	var keys []uint64
+	for i := 0; i < 5*1000; i++ {
+		key := uint64(r.Int63())
+		simstore.InsertHash(key, int64(i))
+		keys = append(keys, key)
+	}
+
+	prefix := keys[0]
+	for _, length := range []uint8{0, 4, 8, 12, 16, 64} {
+		mask := ^uint64(0)
+		if length < 64 {
+			mask = (1 << length) - 1
+		}
+		expected := 0
+		for _, key := range keys {
+			if key&mask == prefix&mask {
+				expected++
+			}
+		}
+
+		found := 0
+		for hash := range simstore.InRange(prefix, length) {
+			if hash&mask != prefix&mask {
+				t.Errorf("InRange(%d) returned %016x which doesn't match the prefix", length, hash)
+			}
+			found++
+		}
+		if found != expected {
+			t.Errorf("InRange(%d) returned %d items, expected %d", length, found, expected)
+		}
+	}
+}
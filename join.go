@@ -0,0 +1,96 @@
+package simhashing
+
+// Calls fn for every pair of an item a in s and an item b in other with a Hamming Distance of k or less.
+// Both tries split on the same bytes at the same level, so we walk them side by side and only
+// descend into pairs of subtrees whose prefixes are still within k of each other.
+func (s *SimStore) Join(other *SimStore, k uint8, fn func(a, b int64, distance uint8)) {
+	join(s, other, k, 0, false, fn)
+}
+
+// Calls fn for every pair of different items in s with a Hamming Distance of k or less.
+// Every pair is reported once, with a <= b.
+func (s *SimStore) SelfJoin(k uint8, fn func(a, b int64, distance uint8)) {
+	join(s, s, k, 0, true, func(a, b int64, distance uint8) {
+		if a > b {
+			a, b = b, a
+		}
+		fn(a, b, distance)
+	})
+}
+
+// x and y are always at the same level, spent is the distance between their prefixes
+// with self set, x and y are in the same tree and we need to avoid reporting pairs twice
+func join(x, y *SimStore, k uint8, spent uint8, self bool, fn func(a, b int64, distance uint8)) {
+
+	// both the same leaf: every pair in it once
+	if self && x == y && len(x.nodes) == 0 {
+		for i, a := range x.values {
+			for _, b := range x.values[i+1:] {
+				if d := hamming_distance(a.key, b.key); d <= k {
+					fn(a.id, b.id, d)
+				}
+			}
+		}
+		return
+	}
+
+	// if either side is a leaf we search the other side for each of its keys
+	if len(x.nodes) == 0 {
+		for _, a := range x.values {
+			y.within(a.key, k, spent, func(b entry, d uint8) {
+				fn(a.id, b.id, d)
+			})
+		}
+		return
+	}
+	if len(y.nodes) == 0 {
+		for _, b := range y.values {
+			x.within(b.key, k, spent, func(a entry, d uint8) {
+				fn(a.id, b.id, d)
+			})
+		}
+		return
+	}
+
+	// both have nodes: pair up every subtree of x with the subtrees of y that are close enough
+	end := min(8, k-spent)
+	for px, cx := range x.nodes {
+		for i := uint8(0); i <= end; i++ {
+			for _, py := range distance_table[px][i] {
+				// in the same tree (cx, cy) and (cy, cx) are the same pairs
+				if self && x == y && py < px {
+					continue
+				}
+				cy, exists := y.nodes[py]
+				if exists {
+					join(cx, cy, k, spent+i, self, fn)
+				}
+			}
+		}
+	}
+}
+
+// calls fn for every item in s within distance k of target,
+// spent is the distance already used up by the bytes before s.level
+func (s *SimStore) within(target uint64, k uint8, spent uint8, fn func(item entry, distance uint8)) {
+
+	if len(s.nodes) == 0 {
+		for _, item := range s.values {
+			if d := hamming_distance(item.key, target); d <= k {
+				fn(item, d)
+			}
+		}
+		return
+	}
+
+	b := int((level_chunks[s.level] & target) >> (s.level * bits_per_key)) // this gets you the Nth byte
+	end := min(8, k-spent)
+	for i := uint8(0); i <= end; i++ {
+		for _, d := range distance_table[b][i] {
+			subtree, exists := s.nodes[d]
+			if exists {
+				subtree.within(target, k, spent+i, fn)
+			}
+		}
+	}
+}
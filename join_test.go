@@ -0,0 +1,127 @@
+package simhashing
+
+import "testing"
+import "fmt"
+import "math/rand"
+
+type pair struct {
+	a, b     int64
+	distance uint8
+}
+
+// random keys that are mostly near-duplicates of a few base keys so there's something to find
+func join_keys(r *rand.Rand, n int) []uint64 {
+
+	base := []uint64{uint64(r.Int63()), uint64(r.Int63()), uint64(r.Int63())}
+	keys := make([]uint64, n)
+	for i := range keys {
+		if i%2 == 0 {
+			keys[i] = uint64(r.Int63())
+			continue
+		}
+		keys[i] = base[i%len(base)]
+		for flips := r.Intn(6); flips > 0; flips-- {
+			keys[i] ^= 1 << uint(r.Intn(64))
+		}
+	}
+
+	return keys
+}
+
+func TestJoin(t *testing.T) {
+
+	r := rand.New(rand.NewSource(8080))
+	left_keys := join_keys(r, 2*1000)
+	right_keys := join_keys(r, 600)
+
+	left := NewSimStore()
+	for i, key := range left_keys {
+		left.InsertHash(key, int64(i))
+	}
+	right := NewSimStore()
+	for i, key := range right_keys {
+		right.InsertHash(key, int64(i))
+	}
+
+	expected := make(map[pair]bool)
+	for i, a := range left_keys {
+		for j, b := range right_keys {
+			if d := hamming_distance(a, b); d <= 5 {
+				expected[pair{int64(i), int64(j), d}] = true
+			}
+		}
+	}
+
+	found := make(map[pair]bool)
+	left.Join(right, 5, func(a, b int64, distance uint8) {
+		p := pair{a, b, distance}
+		if found[p] {
+			t.Errorf("Pair %v reported twice", p)
+		}
+		found[p] = true
+	})
+
+	if len(found) != len(expected) {
+		t.Errorf("Join found %d pairs, expected %d", len(found), len(expected))
+	}
+	for p := range expected {
+		if !found[p] {
+			t.Errorf("Join missed %v", p)
+		}
+	}
+}
+
+func TestSelfJoin(t *testing.T) {
+
+	r := rand.New(rand.NewSource(9090))
+	keys := join_keys(r, 3*1000)
+
+	simstore := NewSimStore()
+	for i, key := range keys {
+		simstore.InsertHash(key, int64(i))
+	}
+
+	expected := make(map[pair]bool)
+	for i := range keys {
+		for j := i + 1; j < len(keys); j++ {
+			if d := hamming_distance(keys[i], keys[j]); d <= 4 {
+				expected[pair{int64(i), int64(j), d}] = true
+			}
+		}
+	}
+	if len(expected) == 0 {
+		t.Fatal("Test data doesn't have any pairs")
+	}
+
+	found := make(map[pair]bool)
+	simstore.SelfJoin(4, func(a, b int64, distance uint8) {
+		p := pair{a, b, distance}
+		if a > b || found[p] {
+			t.Errorf("Pair %v reported twice or in the wrong order", p)
+		}
+		found[p] = true
+	})
+
+	if len(found) != len(expected) {
+		t.Errorf("SelfJoin found %d pairs, expected %d", len(found), len(expected))
+	}
+	for p := range expected {
+		if !found[p] {
+			t.Errorf("SelfJoin missed %v", p)
+		}
+	}
+}
+
+func BenchmarkSelfJoin(b *testing.B) {
+
+	simstore := NewSimStore()
+	r := rand.New(rand.NewSource(45342))
+	for i := 0; i < 20*1000; i++ {
+		simstore.Insert(fmt.Sprintf("%016x", r.Int63()), int64(i))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		simstore.SelfJoin(3, func(a, b int64, distance uint8) {})
+	}
+}
@@ -0,0 +1,97 @@
+package simhashing
+
+import "math/bits"
+import "sort"
+
+// Same as SimHash, but also returns how sure we are of every bit: |counts[i]| from the vote.
+// A bit with a margin of 0 or 1 flips as soon as one shingle changes.
+func SimHashWithMargins(src string) (simhash uint64, margins [64]int) {
+
+	return margins_from_counts(simhash_counts(src))
+}
+
+func margins_from_counts(counts [64]int) (simhash uint64, margins [64]int) {
+
+	simhash = simhash_from_counts(&counts)
+
+	for i, c := range counts {
+		if c < 0 {
+			c = -c
+		}
+		margins[i] = c
+	}
+
+	return
+}
+
+// Returns a mask with the n bits that have the smallest margins (ties go to the lower bit)
+func WeakBits(margins [64]int, n int) (mask uint64) {
+
+	order := make([]int, 64)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return margins[order[i]] < margins[order[j]] })
+
+	for i := 0; i < n && i < 64; i++ {
+		mask |= 1 << uint(order[i])
+	}
+
+	return
+}
+
+// Returns a mask with all bits with a margin of at most threshold
+func WeakBitsBelow(margins [64]int, threshold int) (mask uint64) {
+
+	for i, m := range margins {
+		if m <= threshold {
+			mask |= 1 << uint(i)
+		}
+	}
+
+	return
+}
+
+// Like Find, but the n least certain bits of the text's simhash are wildcards: they don't count
+// towards the distance. That finds the near-duplicates that only differ from us in bits that
+// a tiny edit could have flipped, which improves recall at small distances.
+func (s *SimStore) FindWithWeakBits(text string, distance uint8, n int) (found []int64, keys_checked int, nodes_checked int) {
+
+	target, margins := s.hash_with_margins(text)
+	return s.FindHashWildcard(target, WeakBits(margins, n), distance)
+}
+
+// Like FindHash, but bits set in wildcards are ignored when comparing
+func (s *SimStore) FindHashWildcard(target uint64, wildcards uint64, distance uint8) (found []int64, keys_checked int, nodes_checked int) {
+
+	found = make([]int64, 0)
+	s.find_wildcard(target, wildcards, distance, &found, &keys_checked, &nodes_checked)
+
+	return
+}
+
+// same as find(), but the distance_table can't help us here since the wildcards change
+// which bytes are close, so we look at every subtree and mask the byte distance ourselves
+func (s *SimStore) find_wildcard(target uint64, wildcards uint64, distance uint8, found *[]int64, keys_checked *int, nodes_checked *int) {
+
+	if len(s.nodes) > 0 {
+		b := uint8((level_chunks[s.level] & target) >> (s.level * bits_per_key))    // this gets you the Nth byte
+		w := uint8((level_chunks[s.level] & wildcards) >> (s.level * bits_per_key)) // and which bits of it we don't care about
+		for prefix, subtree := range s.nodes {
+			d := hamming[b&^w][prefix&^w]
+			if d <= distance {
+				subtree.find_wildcard(target, wildcards, distance-d, found, keys_checked, nodes_checked)
+			}
+		}
+		*nodes_checked += len(s.nodes)
+		return
+	}
+
+	mask := masks[s.level] &^ wildcards
+	for _, item := range s.values {
+		if bits.OnesCount64((item.key^target)&mask) <= int(distance) {
+			*found = append(*found, item.id)
+		}
+	}
+	*keys_checked += len(s.values)
+}
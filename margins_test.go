@@ -0,0 +1,86 @@
+package simhashing
+
+import "testing"
+import "fmt"
+import "math/bits"
+import "math/rand"
+
+func TestSimHashWithMargins(t *testing.T) {
+
+	text := "It was the best of times, it was the worst of times,"
+	hash, margins := SimHashWithMargins(text)
+	if hash != SimHash(text) {
+		t.Error("SimHashWithMargins doesn't agree with SimHash")
+	}
+
+	counts := simhash_counts(text)
+	for i, m := range margins {
+		if m < 0 || (m != counts[i] && m != -counts[i]) {
+			t.Errorf("Bit %d has margin %d, count is %d", i, m, counts[i])
+		}
+	}
+
+	weak := WeakBits(margins, 5)
+	if bits.OnesCount64(weak) != 5 {
+		t.Errorf("Expected 5 weak bits, got %064b", weak)
+	}
+	// no strong bit can have a smaller margin than a weak one
+	for i := 0; i < 64; i++ {
+		for j := 0; j < 64; j++ {
+			if weak&(1<<uint(i)) != 0 && weak&(1<<uint(j)) == 0 && margins[i] > margins[j] {
+				t.Errorf("Bit %d is weak with margin %d but bit %d isn't with %d", i, margins[i], j, margins[j])
+			}
+		}
+	}
+
+	if WeakBitsBelow(margins, 1000) != ^uint64(0) || WeakBitsBelow(margins, -1) != 0 {
+		t.Error("WeakBitsBelow with extreme thresholds")
+	}
+}
+
+func TestFindHashWildcard(t *testing.T) {
+
+	simstore := NewSimStore()
+
+	r := rand.New(rand.NewSource(8086))
+	var keys []uint64
+	for i := 0; i < 5*1000; i++ {
+		key := SimHash(fmt.Sprintf("%016x", r.Int63()))
+		simstore.InsertHash(key, int64(i))
+		keys = append(keys, key)
+	}
+
+	target := keys[42] ^ 0x0101010101
+	for _, wildcards := range []uint64{0, 0x0101010101, 0xf0f0, 1 << 63} {
+		for _, distance := range []uint8{0, 2, 6} {
+			expected := 0
+			for _, key := range keys {
+				if bits.OnesCount64((key^target)&^wildcards) <= int(distance) {
+					expected++
+				}
+			}
+			found, _, _ := simstore.FindHashWildcard(target, wildcards, distance)
+			if len(found) != expected {
+				t.Errorf("Wildcards %x distance %d: found %d, expected %d", wildcards, distance, len(found), expected)
+			}
+		}
+	}
+
+	// without wildcards it's just Find
+	expected, _, _ := simstore.FindHash(target, 6)
+	found, _, _ := simstore.FindHashWildcard(target, 0, 6)
+	if !int64array_sameset(expected, found) {
+		t.Error("FindHashWildcard without wildcards differs from FindHash")
+	}
+
+	// the weak bits of an exact copy don't matter
+	simstore.Insert("It was the best of times, it was the worst of times,", -1)
+	found, _, _ = simstore.FindWithWeakBits("It was the best of times, it was the worst of times,", 0, 8)
+	present := false
+	for _, id := range found {
+		present = present || id == -1
+	}
+	if !present {
+		t.Error("FindWithWeakBits didn't find the exact copy")
+	}
+}
@@ -0,0 +1,311 @@
+package simhashing
+
+import "bufio"
+import "expvar"
+import "fmt"
+import "io"
+import "net/http"
+import "sort"
+import "sync"
+import "sync/atomic"
+import "time"
+
+// Counters and histograms for a SimStore, exported in the Prometheus text format
+// or as an expvar map. Only uses the standard library.
+//
+// Inserts, deletes, splits, queries and nodes are counted as they happen. The shape of the
+// tree (depth, leaf occupancy) is computed by walking it when the metrics are read,
+// so the store must not be changed while that happens (same as for every other read).
+type Metrics struct {
+	store *SimStore
+
+	inserts atomic.Int64
+	deletes atomic.Int64
+	splits  atomic.Int64
+	nodes   atomic.Int64 // kept up to date by the store, so reading it doesn't walk the tree
+
+	mu            sync.Mutex
+	keys_checked  map[string]*histogram // per query type
+	nodes_checked map[string]*histogram
+	latency       map[string]*histogram
+}
+
+// upper bounds of the histogram buckets
+var (
+	count_buckets     = []float64{1, 4, 16, 64, 256, 1024, 4096, 16384, 65536, 262144, 1048576}
+	latency_buckets   = []float64{0.00001, 0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+	occupancy_buckets = []float64{0, 1, 2, 4, 8, 16, 32, 64, 128, max_keys_per_node}
+)
+
+// Creates Metrics, use SimStore.SetMetrics to start recording
+func NewMetrics() *Metrics {
+	return &Metrics{
+		keys_checked:  make(map[string]*histogram),
+		nodes_checked: make(map[string]*histogram),
+		latency:       make(map[string]*histogram),
+	}
+}
+
+// Starts recording metrics for this store in m (nil stops recording)
+func (s *SimStore) SetMetrics(m *Metrics) {
+
+	if m != nil {
+		m.store = s
+		_, nodes := s.Stats()
+		m.nodes.Store(int64(nodes))
+	}
+
+	s.set_metrics(m)
+}
+
+func (s *SimStore) set_metrics(m *Metrics) {
+
+	s.metrics = m
+	for _, subtree := range s.nodes {
+		subtree.set_metrics(m)
+	}
+}
+
+// all of these are no-ops on nil Metrics so the store doesn't have to check
+
+func (m *Metrics) inserted() {
+	if m != nil {
+		m.inserts.Add(1)
+	}
+}
+
+func (m *Metrics) deleted() {
+	if m != nil {
+		m.deletes.Add(1)
+	}
+}
+
+func (m *Metrics) split() {
+	if m != nil {
+		m.splits.Add(1)
+	}
+}
+
+// n subtrees were added to the tree (or removed, if n < 0)
+func (m *Metrics) nodes_changed(n int) {
+	if m != nil {
+		m.nodes.Add(int64(n))
+	}
+}
+
+// records a query of some kind that started at start, keys/nodes < 0 means we don't know those
+func (m *Metrics) queried(kind string, start time.Time, keys int, nodes int) {
+
+	if m == nil {
+		return
+	}
+
+	elapsed := time.Since(start).Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	get_histogram(m.latency, kind, latency_buckets).observe(elapsed)
+	if keys >= 0 {
+		get_histogram(m.keys_checked, kind, count_buckets).observe(float64(keys))
+	}
+	if nodes >= 0 {
+		get_histogram(m.nodes_checked, kind, count_buckets).observe(float64(nodes))
+	}
+}
+
+func get_histogram(histograms map[string]*histogram, kind string, buckets []float64) *histogram {
+
+	h, exists := histograms[kind]
+	if !exists {
+		h = new_histogram(buckets)
+		histograms[kind] = h
+	}
+
+	return h
+}
+
+// the shape of the tree at the time we looked
+type shape struct {
+	keys      int
+	nodes     int
+	depth     int
+	occupancy *histogram // number of keys per leaf
+}
+
+func (m *Metrics) shape() shape {
+
+	sh := shape{occupancy: new_histogram(occupancy_buckets)}
+	if m.store == nil {
+		return sh
+	}
+
+	sh.keys, sh.nodes = m.store.Len(), int(m.nodes.Load())
+
+	var visit func(s *SimStore)
+	visit = func(s *SimStore) {
+		if int(s.level) > sh.depth {
+			sh.depth = int(s.level)
+		}
+		if len(s.nodes) == 0 {
+			sh.occupancy.observe(float64(len(s.values)))
+			return
+		}
+		for _, subtree := range s.nodes {
+			visit(subtree)
+		}
+	}
+	visit(m.store)
+
+	return sh
+}
+
+// Writes all metrics in the Prometheus text exposition format
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+
+	bw := bufio.NewWriter(w)
+	sh := m.shape()
+
+	write_metric(bw, "simhash_inserts_total", "counter", "Number of items inserted.", m.inserts.Load())
+	write_metric(bw, "simhash_deletes_total", "counter", "Number of items deleted.", m.deletes.Load())
+	write_metric(bw, "simhash_splits_total", "counter", "Number of times a leaf was split into nodes.", m.splits.Load())
+	write_metric(bw, "simhash_keys", "gauge", "Number of keys in the store.", sh.keys)
+	write_metric(bw, "simhash_nodes", "gauge", "Number of nodes in the store.", sh.nodes)
+	write_metric(bw, "simhash_tree_depth", "gauge", "Deepest level in the tree.", sh.depth)
+
+	fmt.Fprintf(bw, "# HELP simhash_leaf_occupancy Number of keys per leaf.\n# TYPE simhash_leaf_occupancy histogram\n")
+	sh.occupancy.write(bw, "simhash_leaf_occupancy", "")
+
+	m.mu.Lock()
+	write_histograms(bw, "simhash_query_keys_checked", "Keys checked per query.", m.keys_checked)
+	write_histograms(bw, "simhash_query_nodes_checked", "Nodes checked per query.", m.nodes_checked)
+	write_histograms(bw, "simhash_query_duration_seconds", "Query latency in seconds.", m.latency)
+	m.mu.Unlock()
+
+	return bw.Flush()
+}
+
+func write_metric(w io.Writer, name, kind, help string, value interface{}) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, kind, name, value)
+}
+
+// one histogram per query type, labelled with it (in sorted order so the output is stable)
+func write_histograms(w io.Writer, name, help string, histograms map[string]*histogram) {
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+
+	kinds := make([]string, 0, len(histograms))
+	for kind := range histograms {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	for _, kind := range kinds {
+		histograms[kind].write(w, name, fmt.Sprintf("query=%q", kind))
+	}
+}
+
+// Returns an http.Handler serving the metrics for Prometheus to scrape
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.WritePrometheus(w)
+	})
+}
+
+// Returns the metrics as an expvar.Var, for example:
+//
+//	expvar.Publish("simhash", metrics.Expvar())
+func (m *Metrics) Expvar() expvar.Var {
+	return expvar.Func(func() interface{} {
+		return m.Map()
+	})
+}
+
+// Returns all metrics as a map that encodes to JSON nicely
+func (m *Metrics) Map() map[string]interface{} {
+
+	sh := m.shape()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return map[string]interface{}{
+		"inserts":        m.inserts.Load(),
+		"deletes":        m.deletes.Load(),
+		"splits":         m.splits.Load(),
+		"keys":           sh.keys,
+		"nodes":          sh.nodes,
+		"tree_depth":     sh.depth,
+		"leaf_occupancy": sh.occupancy.snapshot(),
+		"keys_checked":   snapshot_histograms(m.keys_checked),
+		"nodes_checked":  snapshot_histograms(m.nodes_checked),
+		"latency":        snapshot_histograms(m.latency),
+	}
+}
+
+func snapshot_histograms(histograms map[string]*histogram) map[string]interface{} {
+
+	out := make(map[string]interface{}, len(histograms))
+	for kind, h := range histograms {
+		out[kind] = h.snapshot()
+	}
+
+	return out
+}
+
+// a Prometheus style histogram, not safe for concurrent use by itself
+type histogram struct {
+	bounds []float64
+	counts []uint64 // counts[i] is the number of observations <= bounds[i] (not cumulative), last one is +Inf
+	sum    float64
+	count  uint64
+}
+
+func new_histogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(v float64) {
+
+	i := sort.SearchFloat64s(h.bounds, v) // first bound >= v
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// writes the _bucket, _sum and _count lines, labels is something like `query="find"` or ""
+func (h *histogram) write(w io.Writer, name string, labels string) {
+
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{%s%sle=\"%g\"} %d\n", name, labels, sep, bound, cumulative)
+	}
+	cumulative += h.counts[len(h.bounds)]
+	fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, cumulative)
+
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %g\n", name, labels, h.sum)
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, h.count)
+}
+
+func (h *histogram) snapshot() map[string]interface{} {
+
+	buckets := make(map[string]uint64, len(h.counts))
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		buckets[fmt.Sprintf("%g", bound)] = cumulative
+	}
+	buckets["+Inf"] = cumulative + h.counts[len(h.bounds)]
+
+	return map[string]interface{}{"buckets": buckets, "sum": h.sum, "count": h.count}
+}
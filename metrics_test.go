@@ -0,0 +1,113 @@
+package simhashing
+
+import "testing"
+import "encoding/json"
+import "expvar"
+import "fmt"
+import "math/rand"
+import "net/http/httptest"
+import "strings"
+
+func TestMetrics(t *testing.T) {
+
+	simstore := NewSimStore()
+	metrics := NewMetrics()
+	simstore.SetMetrics(metrics)
+
+	r := rand.New(rand.NewSource(404))
+	for i := 0; i < 2*1000; i++ {
+		simstore.Insert(fmt.Sprintf("%016x", r.Int63()), int64(i))
+	}
+	simstore.Delete(fmt.Sprintf("%016x", 12345), 1) // not there
+	simstore.Find("It was the best of times", 3)
+	simstore.Find("It was the worst of times", 3)
+	simstore.FindNearest("It was the best of times", 5)
+	simstore.FindByProbing("It was the best of times", 1)
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	out := rec.Body.String()
+
+	for _, line := range []string{
+		"simhash_inserts_total 2000\n",
+		"simhash_deletes_total 0\n",
+		"simhash_keys 2000\n",
+		"simhash_tree_depth 1\n",
+		"simhash_query_keys_checked_count{query=\"find\"} 2\n",
+		"simhash_query_duration_seconds_count{query=\"find_nearest\"} 1\n",
+		"simhash_query_duration_seconds_bucket{query=\"find\",le=\"+Inf\"} 2\n",
+		"simhash_query_duration_seconds_count{query=\"find_probing\"} 1\n",
+		"# TYPE simhash_leaf_occupancy histogram\n",
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("Metrics output is missing %q", line)
+		}
+	}
+
+	// splits happen in subtrees, which must also record them
+	if !strings.Contains(out, "simhash_splits_total ") || strings.Contains(out, "simhash_splits_total 0\n") {
+		t.Errorf("Splits were not recorded")
+	}
+
+	// every leaf is counted once, and the node count is kept without walking the tree
+	_, nodes := simstore.Stats()
+	if !strings.Contains(out, fmt.Sprintf("simhash_nodes %d\n", nodes)) {
+		t.Errorf("Metrics don't have all %d nodes", nodes)
+	}
+	if !strings.Contains(out, fmt.Sprintf("simhash_leaf_occupancy_count %d\n", nodes)) {
+		t.Errorf("Leaf occupancy doesn't count all %d leaves", nodes)
+	}
+}
+
+func TestMetricsNodeCount(t *testing.T) {
+
+	simstore := NewSimStore()
+	r := rand.New(rand.NewSource(404))
+	var texts []string
+	for i := 0; i < 2*1000; i++ {
+		texts = append(texts, fmt.Sprintf("%016x", r.Int63()))
+		if i == 1000 {
+			simstore.SetMetrics(NewMetrics()) // starts counting from what's already there
+		}
+		simstore.Insert(texts[i], int64(i))
+	}
+
+	check := func(when string) {
+		_, nodes := simstore.Stats()
+		if sh := simstore.metrics.shape(); sh.nodes != nodes || sh.keys != simstore.Len() {
+			t.Errorf("%s: metrics have %d nodes and %d keys, the store %d and %d", when, sh.nodes, sh.keys, nodes, simstore.Len())
+		}
+	}
+	check("after inserts")
+
+	// empty subtrees get dropped
+	for i, text := range texts[:1900] {
+		simstore.Delete(text, int64(i))
+	}
+	check("after deletes")
+}
+
+func TestMetricsExpvar(t *testing.T) {
+
+	simstore := NewSimStore()
+	metrics := NewMetrics()
+	simstore.SetMetrics(metrics)
+	simstore.Insert("It was the best of times", 1)
+	simstore.Find("It was the best of times", 0)
+
+	var v expvar.Var = metrics.Expvar()
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(v.String()), &decoded); err != nil {
+		t.Fatalf("Expvar output is not JSON: %v", err)
+	}
+	if decoded["inserts"] != float64(1) || decoded["keys"] != float64(1) {
+		t.Errorf("Unexpected expvar output %v", decoded)
+	}
+
+	// no metrics, no problem
+	simstore.SetMetrics(nil)
+	simstore.Insert("It was the worst of times", 2)
+	if metrics.Map()["inserts"] != int64(1) {
+		t.Error("Metrics kept recording after SetMetrics(nil)")
+	}
+}
@@ -0,0 +1,163 @@
+package simhashing
+
+import "iter"
+import "sort"
+import "time"
+
+// Multi-probing: instead of fanning out over the trie, generate every hash within the
+// distance and look each one up with the exact path contains() uses.
+// This is the "flip every bit" idea from FindClosest, and for small distances on big
+// stores it checks a lot fewer keys than find() does.
+
+// Yields every hash within max_distance of target and its distance, closest first.
+// With margins (from SimHashWithMargins) the bits we're least sure about get flipped first,
+// so the likeliest near-duplicates come early if you stop before the end.
+// There are sum(C(64, d)) of these, so keep max_distance small (3 is already ~43K probes).
+func Probes(target uint64, max_distance uint8, margins *[64]int) iter.Seq2[uint64, uint8] {
+
+	// the order in which we pick bits to flip
+	order := make([]uint, 64)
+	for i := range order {
+		order[i] = uint(i)
+	}
+	if margins != nil {
+		sort.SliceStable(order, func(i, j int) bool { return margins[order[i]] < margins[order[j]] })
+	}
+
+	return func(yield func(uint64, uint8) bool) {
+
+		if !yield(target, 0) {
+			return
+		}
+
+		// all combinations of d positions in order, as indices into order
+		for d := 1; d <= int(max_distance) && d <= 64; d++ {
+			picks := make([]int, d)
+			for i := range picks {
+				picks[i] = i
+			}
+			for {
+				probe := target
+				for _, p := range picks {
+					probe ^= 1 << order[p]
+				}
+				if !yield(probe, uint8(d)) {
+					return
+				}
+
+				// next combination: move the rightmost pick that can still move
+				i := d - 1
+				for i >= 0 && picks[i] == 64-d+i {
+					i--
+				}
+				if i < 0 {
+					break
+				}
+				picks[i]++
+				for j := i + 1; j < d; j++ {
+					picks[j] = picks[j-1] + 1
+				}
+			}
+		}
+	}
+}
+
+// Same result as Find (in a different order), but by probing every hash within distance.
+// Also returns how many probes were done.
+func (s *SimStore) FindByProbing(text string, distance uint8) (found []int64, probes int) {
+	target, margins := s.hash_with_margins(text)
+	return s.find_probing(target, distance, &margins)
+}
+
+// records the query in the metrics like FindHash does, so FindAuto is counted whichever way it goes
+func (s *SimStore) find_probing(target uint64, distance uint8, margins *[64]int) (found []int64, probes int) {
+
+	start := time.Now()
+	found = make([]int64, 0)
+	for probe := range Probes(target, distance, margins) {
+		probes++
+		found = s.exact(probe, found)
+	}
+	s.metrics.queried("find_probing", start, -1, -1)
+
+	return
+}
+
+// appends the ids of all items with exactly this key (contains() stops at the first one)
+func (s *SimStore) exact(target uint64, found []int64) []int64 {
+
+	node := s
+	for len(node.nodes) > 0 {
+		b := uint8((level_chunks[node.level] & target) >> (node.level * bits_per_key)) // this gets you the Nth byte
+		subtree, exists := node.nodes[b]
+		if !exists {
+			return found
+		}
+		node = subtree
+	}
+
+	for _, item := range node.values {
+		if item.key == target {
+			found = append(found, item.id)
+		}
+	}
+
+	return found
+}
+
+// How many probes there are for a distance: sum of C(64, d) for d <= distance
+func probe_count(distance uint8) float64 {
+
+	total, c := 1.0, 1.0
+	for d := 1; d <= int(distance) && d <= 64; d++ {
+		c = c * float64(64-d+1) / float64(d)
+		total += c
+	}
+
+	return total
+}
+
+// Guesses if probing is cheaper than a trie search for this distance, based on the store size.
+//
+// A probe walks down to a leaf and scans it, so costs about a leaf's worth of keys.
+// A trie search at least visits every first level subtree within distance of the target's
+// byte, which for random keys is sum(C(8, d))/256 of the store, and then some.
+func (s *SimStore) prefer_probing(distance uint8) bool {
+
+	n := float64(s.num_keys)
+	if n == 0 {
+		return false
+	}
+
+	leaf := n
+	if n > max_keys_per_node {
+		leaf = max_keys_per_node / 2 // leaves are somewhere between half full and full after splits
+	}
+	probe_cost := probe_count(distance) * leaf
+
+	first_level := 0.0
+	c := 1.0
+	for d := 0; d <= int(distance) && d <= 8; d++ {
+		if d > 0 {
+			c = c * float64(8-d+1) / float64(d)
+		}
+		first_level += c
+	}
+	fanout_cost := n * first_level / size
+
+	return probe_cost < fanout_cost
+}
+
+// Finds everything within distance of text, picking multi-probing or the trie search
+// depending on which one is likely to be cheaper. Returns true if it probed.
+func (s *SimStore) FindAuto(text string, distance uint8) (found []int64, probed bool) {
+
+	target, margins := s.hash_with_margins(text)
+	if s.prefer_probing(distance) {
+		found, _ = s.find_probing(target, distance, &margins)
+		return found, true
+	}
+
+	found, _, _ = s.FindHash(target, distance)
+	return found, false
+}
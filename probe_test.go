@@ -0,0 +1,93 @@
+package simhashing
+
+import "testing"
+import "fmt"
+import "math/rand"
+
+func TestProbes(t *testing.T) {
+
+	target := uint64(0xdeadbeef)
+	seen := make(map[uint64]bool)
+	last := uint8(0)
+	for probe, d := range Probes(target, 2, nil) {
+		if seen[probe] {
+			t.Fatalf("Probe %016x generated twice", probe)
+		}
+		seen[probe] = true
+		if hamming_distance(probe, target) != d || d < last {
+			t.Fatalf("Probe %016x has distance %d, last was %d", probe, d, last)
+		}
+		last = d
+	}
+	if len(seen) != 1+64+2016 || float64(len(seen)) != probe_count(2) {
+		t.Errorf("Expected %d probes, got %d", 1+64+2016, len(seen))
+	}
+
+	// with margins the weakest bit goes first
+	var margins [64]int
+	for i := range margins {
+		margins[i] = 10
+	}
+	margins[37] = 0
+	n := 0
+	for probe, d := range Probes(target, 1, &margins) {
+		if d == 1 {
+			if probe != target^(1<<37) {
+				t.Errorf("First probe at distance 1 should flip bit 37, got %016x", probe^target)
+			}
+			break
+		}
+		n++
+	}
+	if n != 1 {
+		t.Errorf("Expected the target as the only probe at distance 0")
+	}
+}
+
+func TestFindByProbing(t *testing.T) {
+
+	simstore := NewSimStore()
+
+	r := rand.New(rand.NewSource(3000))
+	for i := 0; i < 5*1000; i++ {
+		simstore.Insert(fmt.Sprintf("%016x", r.Int63()), int64(i))
+	}
+	// some near-duplicates so there's something to find
+	base := "It was the best of times, it was the worst of times,"
+	simstore.Insert(base, -1)
+	simstore.Insert(base+" it was", -2)
+	simstore.Insert("It was the best of times, it was the worst of time", -3)
+
+	for _, distance := range []uint8{0, 1, 2} {
+		expected, _, _ := simstore.Find(base, distance)
+		found, probes := simstore.FindByProbing(base, distance)
+		if !int64array_sameset(expected, found) {
+			t.Errorf("Distance %d: probing found %v, Find found %v", distance, found, expected)
+		}
+		if float64(probes) != probe_count(distance) {
+			t.Errorf("Distance %d: did %d probes", distance, probes)
+		}
+	}
+
+	found, probed := simstore.FindAuto(base, 4)
+	expected, _, _ := simstore.Find(base, 4)
+	if probed || !int64array_sameset(expected, found) {
+		t.Errorf("FindAuto should use the trie for a small store: %v %v", probed, found)
+	}
+}
+
+func TestPreferProbing(t *testing.T) {
+
+	big := NewSimStore()
+	big.num_keys = 20 * 1000 * 1000 // pretend
+
+	if !big.prefer_probing(0) || !big.prefer_probing(2) {
+		t.Error("Probing should win for small distances on a big store")
+	}
+	if big.prefer_probing(6) {
+		t.Error("Probing shouldn't win for distance 6")
+	}
+	if NewSimStore().prefer_probing(0) {
+		t.Error("Probing an empty store is pointless")
+	}
+}
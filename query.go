@@ -0,0 +1,199 @@
+package simhashing
+
+import "context"
+import "time"
+
+// Limits for a search, zero means no limit.
+// When a limit is hit the search stops and returns whatever it found so far.
+type Budget struct {
+	MaxKeys    int // maximum number of keys to check
+	MaxNodes   int // maximum number of nodes to check
+	MaxResults int // stop after finding this many results
+}
+
+// What a search did
+type QueryStats struct {
+	KeysChecked  int
+	NodesChecked int
+	Exhaustive   bool // false if the search was cut short by the budget or the context
+}
+
+// keeps track of a search: what it checked so far and if it has to stop
+type query struct {
+	ctx     context.Context
+	budget  Budget
+	stats   QueryStats
+	results int
+	stopped bool
+	err     error           // the context's error, if that's why we stopped
+	visit   func(*SimStore) // if set, called for every node the search looks at
+}
+
+func new_query(ctx context.Context, budget Budget) *query {
+	return &query{ctx: ctx, budget: budget}
+}
+
+// returns true if there's work left but we're not allowed to do it
+// checking the context isn't free, so callers only ask for that once per node
+func (q *query) stop(check_context bool) bool {
+
+	if q.stopped {
+		return true
+	}
+
+	if check_context {
+		if err := q.ctx.Err(); err != nil {
+			q.err = err
+			q.stopped = true
+			return true
+		}
+	}
+
+	b := q.budget
+	if (b.MaxKeys > 0 && q.stats.KeysChecked >= b.MaxKeys) ||
+		(b.MaxNodes > 0 && q.stats.NodesChecked >= b.MaxNodes) ||
+		(b.MaxResults > 0 && q.results >= b.MaxResults) {
+		q.stopped = true
+	}
+
+	return q.stopped
+}
+
+// the stats to return, only exhaustive if we never had to stop
+func (q *query) done() QueryStats {
+	q.stats.Exhaustive = !q.stopped
+	return q.stats
+}
+
+// Same as Find, but stops when ctx is done or the budget runs out.
+// Returns whatever was found until then, err is ctx.Err() if the context is why we stopped.
+func (s *SimStore) FindContext(ctx context.Context, text string, distance uint8, budget Budget) (found []int64, stats QueryStats, err error) {
+
+	start := time.Now()
+	q := new_query(ctx, budget)
+	found = make([]int64, 0)
+	s.find_query(s.hash(text), distance, q, &found)
+	s.metrics.queried("find", start, q.stats.KeysChecked, q.stats.NodesChecked)
+
+	return found, q.done(), q.err
+}
+
+// the search behind find(): appends to found and checks q while going
+func (s *SimStore) find_query(target uint64, distance uint8, q *query, found *[]int64) {
+
+	if q.stop(true) {
+		return
+	}
+	if q.visit != nil {
+		q.visit(s)
+	}
+
+	if len(s.nodes) > 0 {
+		b := int((level_chunks[s.level] & target) >> (s.level * bits_per_key)) // this gets you the Nth byte
+		q.stats.NodesChecked += len(s.nodes)
+
+		// for all bytes that are within distance (with a max of 8) we check all nodes
+		// since hamming_distance is additive
+		// example: looking for 101011 with distance 2
+		// we take the LSBs 11, and find everything that is within distance 2:
+		// (00, 10, 01, 11) and recurse:
+		// node[00].Find( 101011, 0 ) (already 'spent' distance 2)
+		// node[10].Find( 101011, 1)
+		// node[01].Find( 101011, 1)
+		// node[11].Find( 101011, 2) (distance for this subrange was 0, 2 left to 'spend')
+		end := min(8, distance)
+		for i := uint8(0); i <= end; i++ { // check everything withing distance range
+			for _, d := range distance_table[b][i] { // lookup which bytes are that distance from us
+				subtree, exists := s.nodes[d] // check in those subtrees, if they exist
+				if exists {
+					// recurse, but the distance gets smaller
+					subtree.find_query(target, distance-i, q, found)
+					if q.stopped {
+						return
+					}
+				}
+			}
+		}
+		return
+	}
+
+	// we need the part of the hash that has not been matched yet, so the (64 - bits_per_key*(level+1)) MSBs
+	// eg to get the top 12 bits we do 1<<12 (0b1000000000000), -1 (0b0111111111111), then shifted to the MSBs
+	// ehr, so let's just use a lookup ;)
+	mask := masks[s.level]
+
+	// check the keys the budget allows in one go, stopping where checking them one by one would
+	values := s.values
+	budget := q.budget
+	if budget.MaxKeys > 0 && len(values) > budget.MaxKeys-q.stats.KeysChecked {
+		values = values[:budget.MaxKeys-q.stats.KeysChecked]
+		q.stopped = true
+	}
+	checked := len(values)
+
+	var hits [max_keys_per_node + 1]int
+	for _, i := range entries_within(values, target, mask, distance, hits[:0]) {
+		*found = append(*found, values[i].id)
+		q.results++
+		if budget.MaxResults > 0 && q.results >= budget.MaxResults && i+1 < len(values) {
+			checked = i + 1
+			q.stopped = true
+			break
+		}
+	}
+	q.stats.KeysChecked += checked
+}
+
+// Same as FindClosest, but stops when ctx is done or the budget runs out (MaxResults doesn't apply).
+// Returns the closest id found until then, or -1 if nothing was found at all.
+func (s *SimStore) FindClosestContext(ctx context.Context, text string, budget Budget) (closest int64, stats QueryStats, err error) {
+
+	start := time.Now()
+	budget.MaxResults = 0
+	q := new_query(ctx, budget)
+	nearest := s.find_nearest(s.hash(text), 1, q)
+	s.metrics.queried("find_closest", start, q.stats.KeysChecked, q.stats.NodesChecked)
+
+	closest = -1
+	if len(nearest) > 0 {
+		closest = nearest[0].Id
+	}
+
+	return closest, q.done(), q.err
+}
+
+// Same as FindScanAll, but stops when ctx is done or the budget runs out.
+func (s *SimStore) FindScanAllContext(ctx context.Context, target uint64, distance uint8, budget Budget) (found []uint64, stats QueryStats, err error) {
+
+	q := new_query(ctx, budget)
+	found = make([]uint64, 0)
+	s.scan_query(target, distance, q, &found)
+
+	return found, q.done(), q.err
+}
+
+func (s *SimStore) scan_query(target uint64, distance uint8, q *query, found *[]uint64) {
+
+	if q.stop(true) {
+		return
+	}
+
+	q.stats.NodesChecked += len(s.nodes)
+	for _, subtree := range s.nodes {
+		subtree.scan_query(target, distance, q, found)
+		if q.stopped {
+			return
+		}
+	}
+
+	for _, item := range s.values {
+		if q.stop(false) {
+			return
+		}
+		q.stats.KeysChecked++
+		if hamming_distance(item.key, target) <= distance {
+			*found = append(*found, item.key)
+			q.results++
+		}
+	}
+}
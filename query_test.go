@@ -0,0 +1,141 @@
+package simhashing
+
+import "testing"
+import "context"
+import "fmt"
+import "math/rand"
+
+func query_store() *SimStore {
+
+	simstore := NewSimStore()
+	r := rand.New(rand.NewSource(1984))
+	for i := 0; i < 5*1000; i++ {
+		simstore.Insert(fmt.Sprintf("%016x", r.Int63()), int64(i))
+	}
+	simstore.Insert("It was the best of times, it was the worst of times,", -1)
+
+	return simstore
+}
+
+func TestFindContext(t *testing.T) {
+
+	simstore := query_store()
+	query := "It was the best of times and it was the worst of times"
+
+	// without limits it's the same as Find
+	expected, keys_checked, nodes_checked := simstore.Find(query, 12)
+	found, stats, err := simstore.FindContext(context.Background(), query, 12, Budget{})
+	if err != nil || !stats.Exhaustive {
+		t.Errorf("Unlimited search wasn't exhaustive: %v %+v", err, stats)
+	}
+	if !int64array_sameset(expected, found) || stats.KeysChecked != keys_checked || stats.NodesChecked != nodes_checked {
+		t.Errorf("FindContext returned %v %+v, Find returned %v %d %d", found, stats, expected, keys_checked, nodes_checked)
+	}
+
+	found, stats, _ = simstore.FindContext(context.Background(), query, 12, Budget{MaxKeys: 100})
+	if stats.Exhaustive || stats.KeysChecked != 100 {
+		t.Errorf("MaxKeys wasn't respected: %+v", stats)
+	}
+
+	found, stats, _ = simstore.FindContext(context.Background(), query, 20, Budget{MaxResults: 3})
+	if stats.Exhaustive || len(found) != 3 {
+		t.Errorf("MaxResults wasn't respected: %v %+v", found, stats)
+	}
+
+	found, stats, _ = simstore.FindContext(context.Background(), query, 20, Budget{MaxNodes: 10})
+	if stats.Exhaustive {
+		t.Errorf("MaxNodes wasn't respected: %+v", stats)
+	}
+}
+
+func TestFindBudgetInLeaf(t *testing.T) {
+
+	// one leaf of 10 keys where only the 5th is within distance of 0
+	simstore := NewSimStore()
+	for i := 0; i < 10; i++ {
+		key := ^uint64(0)
+		if i == 4 || i == 9 {
+			key = 0
+		}
+		simstore.InsertHash(key, int64(i))
+	}
+
+	search := func(budget Budget) ([]int64, QueryStats) {
+		q := new_query(context.Background(), budget)
+		found := make([]int64, 0)
+		simstore.find_query(0, 0, q, &found)
+		return found, q.done()
+	}
+
+	// the last key the budget allows is also the last result we want
+	found, stats := search(Budget{MaxKeys: 5, MaxResults: 1})
+	if len(found) != 1 || found[0] != 4 || stats.KeysChecked != 5 || stats.Exhaustive {
+		t.Errorf("MaxKeys and MaxResults on the same key returned %v %+v", found, stats)
+	}
+
+	// same, but it's the last key in the store so there was nothing left to skip
+	found, stats = search(Budget{MaxKeys: 10, MaxResults: 2})
+	if len(found) != 2 || stats.KeysChecked != 10 || !stats.Exhaustive {
+		t.Errorf("Budget that covers the whole leaf returned %v %+v", found, stats)
+	}
+
+	// results run out before the keys do
+	found, stats = search(Budget{MaxKeys: 8, MaxResults: 1})
+	if len(found) != 1 || stats.KeysChecked != 5 || stats.Exhaustive {
+		t.Errorf("MaxResults before MaxKeys returned %v %+v", found, stats)
+	}
+}
+
+func TestFindContextCancelled(t *testing.T) {
+
+	simstore := query_store()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	found, stats, err := simstore.FindContext(ctx, "anything", 30, Budget{})
+	if err != context.Canceled || stats.Exhaustive || len(found) != 0 {
+		t.Errorf("Cancelled search returned %v %+v %v", found, stats, err)
+	}
+
+	closest, stats, err := simstore.FindClosestContext(ctx, "anything", Budget{})
+	if err != context.Canceled || stats.Exhaustive || closest != -1 {
+		t.Errorf("Cancelled FindClosestContext returned %d %+v %v", closest, stats, err)
+	}
+
+	_, stats, err = simstore.FindScanAllContext(ctx, 0, 30, Budget{})
+	if err != context.Canceled || stats.Exhaustive {
+		t.Errorf("Cancelled FindScanAllContext returned %+v %v", stats, err)
+	}
+}
+
+func TestFindClosestContext(t *testing.T) {
+
+	simstore := query_store()
+
+	closest, stats, err := simstore.FindClosestContext(context.Background(), "It was the best of times, it was the worst of times,", Budget{})
+	if err != nil || !stats.Exhaustive || closest != -1 {
+		t.Errorf("FindClosestContext returned %d %+v %v", closest, stats, err)
+	}
+
+	_, stats, _ = simstore.FindClosestContext(context.Background(), "It was the best of times", Budget{MaxKeys: 1})
+	if stats.Exhaustive || stats.KeysChecked != 1 {
+		t.Errorf("MaxKeys wasn't respected: %+v", stats)
+	}
+}
+
+func TestFindScanAllContext(t *testing.T) {
+
+	simstore := query_store()
+	target := SimHash("It was the best of times")
+
+	expected := simstore.FindScanAll(target, 20)
+	found, stats, err := simstore.FindScanAllContext(context.Background(), target, 20, Budget{})
+	if err != nil || !stats.Exhaustive || len(found) != len(expected) {
+		t.Errorf("FindScanAllContext returned %d results, expected %d (%+v)", len(found), len(expected), stats)
+	}
+	keys, _ := simstore.Stats()
+	if stats.KeysChecked != keys {
+		t.Errorf("FindScanAllContext checked %d keys, store has %d", stats.KeysChecked, keys)
+	}
+}
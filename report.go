@@ -0,0 +1,238 @@
+package simhashing
+
+import "encoding/json"
+import "fmt"
+import "math"
+import "sort"
+import "strings"
+import "unsafe"
+
+// how many of the largest/smallest leaves a report lists
+const report_leaves = 5
+
+// A detailed look at the shape of a SimStore, see SimStore.Report()
+// Everything in it is sorted, so the same store always gives the same report.
+type StoreReport struct {
+	Keys           int           `json:"keys"`
+	Nodes          int           `json:"nodes"` // same as Stats(): every node except the root
+	Leaves         int           `json:"leaves"`
+	Depth          int           `json:"depth"`      // deepest level
+	BytesUsed      int           `json:"bytes_used"` // an estimate, maps have overhead we can't see
+	Levels         []LevelReport `json:"levels"`
+	LargestLeaves  []LeafReport  `json:"largest_leaves"`
+	SmallestLeaves []LeafReport  `json:"smallest_leaves"`
+	LongestChain   int           `json:"longest_chain"` // most nodes in a row with only 1 subtree
+	Warnings       []string      `json:"warnings"`
+}
+
+// What the tree looks like at one level
+type LevelReport struct {
+	Level      int     `json:"level"`
+	Nodes      int     `json:"nodes"`       // nodes at this level that have subtrees
+	Leaves     int     `json:"leaves"`      // nodes at this level that have keys
+	Keys       int     `json:"keys"`        // keys in the leaves at this level
+	FillFactor float64 `json:"fill_factor"` // keys / (leaves * max_keys_per_node)
+	Skew       float64 `json:"skew"`        // 0 if the keys below this level are spread evenly over all 256 bytes, 1 if they all have the same byte
+	TopByte    int     `json:"top_byte"`    // the byte most keys below this level have (-1 for levels without nodes)
+	TopShare   float64 `json:"top_share"`   // fraction of the keys below this level that have TopByte
+}
+
+// A leaf, Path is the bytes leading to it from the root as hex, like "0a/ff/03"
+type LeafReport struct {
+	Path  string `json:"path"`
+	Level int    `json:"level"`
+	Keys  int    `json:"keys"`
+}
+
+// Walks the whole store and reports on its shape
+func (s *SimStore) Report() *StoreReport {
+
+	r := &StoreReport{Levels: []LevelReport{}, Warnings: []string{}}
+
+	var leaves []LeafReport
+	var byte_counts [][size]int // per level: how many keys below it have each byte
+
+	var visit func(node *SimStore, path []string, chain int)
+	visit = func(node *SimStore, path []string, chain int) {
+
+		level := int(node.level)
+		for len(r.Levels) <= level {
+			r.Levels = append(r.Levels, LevelReport{Level: len(r.Levels), TopByte: -1})
+			byte_counts = append(byte_counts, [size]int{})
+		}
+		if level > r.Depth {
+			r.Depth = level
+		}
+		r.BytesUsed += node_bytes(node)
+
+		if len(node.nodes) == 0 {
+			r.Levels[level].Leaves++
+			r.Levels[level].Keys += len(node.values)
+			r.Keys += len(node.values)
+			leaves = append(leaves, LeafReport{Path: strings.Join(path, "/"), Level: level, Keys: len(node.values)})
+			return
+		}
+
+		r.Levels[level].Nodes++
+		r.Nodes += len(node.nodes)
+
+		// a run of nodes with 1 subtree each means every key below shares those bytes
+		if len(node.nodes) == 1 {
+			chain++
+			if chain > r.LongestChain {
+				r.LongestChain = chain
+			}
+		} else {
+			chain = 0
+		}
+
+		for _, prefix := range node.prefixes() {
+			subtree := node.nodes[prefix]
+			byte_counts[level][prefix] += subtree.num_keys
+			visit(subtree, append(path[:len(path):len(path)], fmt.Sprintf("%02x", prefix)), chain)
+		}
+	}
+	visit(s, nil, 0)
+
+	r.Leaves = len(leaves)
+
+	for level := range r.Levels {
+		lr := &r.Levels[level]
+		if lr.Leaves > 0 {
+			lr.FillFactor = float64(lr.Keys) / float64(lr.Leaves*max_keys_per_node)
+		}
+		if lr.Nodes > 0 {
+			lr.Skew, lr.TopByte, lr.TopShare = skew(byte_counts[level])
+		}
+	}
+
+	// largest first, then smallest first, ties by path
+	sort.Slice(leaves, func(i, j int) bool {
+		if leaves[i].Keys != leaves[j].Keys {
+			return leaves[i].Keys > leaves[j].Keys
+		}
+		return leaves[i].Path < leaves[j].Path
+	})
+	largest := leaves
+	if len(largest) > report_leaves {
+		largest = largest[:report_leaves]
+	}
+	r.LargestLeaves = append([]LeafReport{}, largest...)
+	r.SmallestLeaves = []LeafReport{}
+	for i := len(leaves) - 1; i >= 0 && len(r.SmallestLeaves) < report_leaves; i-- {
+		r.SmallestLeaves = append(r.SmallestLeaves, leaves[i])
+	}
+
+	r.Warnings = r.pathologies()
+
+	return r
+}
+
+// 1 - (entropy / 8 bits) of the distribution of keys over bytes, and the most common byte
+func skew(counts [size]int) (skew float64, top_byte int, top_share float64) {
+
+	total := 0
+	top_byte = -1
+	for b, c := range counts {
+		total += c
+		if top_byte == -1 || c > counts[top_byte] {
+			top_byte = b
+		}
+	}
+	if total == 0 {
+		return 0, -1, 0
+	}
+
+	entropy := 0.0
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / float64(total)
+			entropy -= p * math.Log2(p)
+		}
+	}
+
+	return 1 - entropy/bit_length, top_byte, float64(counts[top_byte]) / float64(total)
+}
+
+// things that mean the tree isn't doing its job
+func (r *StoreReport) pathologies() []string {
+
+	warnings := []string{}
+
+	if r.LongestChain >= 2 {
+		warnings = append(warnings, fmt.Sprintf("chain of %d nodes with a single subtree: many keys share the same low bytes", r.LongestChain))
+	}
+
+	for _, lr := range r.Levels {
+		if lr.Nodes > 0 && lr.Skew > 0.5 {
+			warnings = append(warnings, fmt.Sprintf("level %d is skewed (%.2f): %.0f%% of the keys below it have byte %02x", lr.Level, lr.Skew, 100*lr.TopShare, lr.TopByte))
+		}
+		if lr.Leaves > 10 && lr.FillFactor < 0.05 {
+			warnings = append(warnings, fmt.Sprintf("leaves at level %d are nearly empty (fill factor %.3f)", lr.Level, lr.FillFactor))
+		}
+	}
+
+	// leaves below the last level have matched every byte, so they only hold copies of one key
+	if r.Depth >= len(level_chunks) {
+		warnings = append(warnings, fmt.Sprintf("tree is %d levels deep: more than %d copies of the same key", r.Depth, max_keys_per_node))
+	}
+
+	return warnings
+}
+
+// rough memory use of a single node: the struct, its map and its values
+func node_bytes(node *SimStore) int {
+
+	bytes := int(unsafe.Sizeof(*node))
+	bytes += cap(node.values) * int(unsafe.Sizeof(entry{}))
+	if node.nodes != nil {
+		// map header plus a key, a pointer and some bookkeeping per entry
+		bytes += 48 + len(node.nodes)*(1+int(unsafe.Sizeof(node))+8)
+	}
+
+	return bytes
+}
+
+// Renders the report as (deterministic) indented JSON
+func (r *StoreReport) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// Renders the report as text
+func (r *StoreReport) String() string {
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "keys %d, nodes %d, leaves %d, depth %d, ~%d bytes\n", r.Keys, r.Nodes, r.Leaves, r.Depth, r.BytesUsed)
+
+	fmt.Fprintf(&b, "\nlevel  nodes  leaves     keys   fill   skew  top byte\n")
+	for _, lr := range r.Levels {
+		top := "-"
+		if lr.TopByte >= 0 {
+			top = fmt.Sprintf("%02x (%.0f%%)", lr.TopByte, 100*lr.TopShare)
+		}
+		fmt.Fprintf(&b, "% 5d % 6d % 7d % 8d % 6.3f % 6.3f  %s\n", lr.Level, lr.Nodes, lr.Leaves, lr.Keys, lr.FillFactor, lr.Skew, top)
+	}
+
+	write_leaves := func(title string, leaves []LeafReport) {
+		fmt.Fprintf(&b, "\n%s\n", title)
+		for _, leaf := range leaves {
+			path := leaf.Path
+			if path == "" {
+				path = "(root)"
+			}
+			fmt.Fprintf(&b, "  %-24s % 4d keys\n", path, leaf.Keys)
+		}
+	}
+	write_leaves("largest leaves", r.LargestLeaves)
+	write_leaves("smallest leaves", r.SmallestLeaves)
+
+	if len(r.Warnings) > 0 {
+		fmt.Fprintf(&b, "\nwarnings\n")
+		for _, w := range r.Warnings {
+			fmt.Fprintf(&b, "  %s\n", w)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,79 @@
+package simhashing
+
+import "testing"
+import "encoding/json"
+import "fmt"
+import "math/rand"
+import "strings"
+
+func TestReport(t *testing.T) {
+
+	simstore := NewSimStore()
+
+	r := rand.New(rand.NewSource(2600))
+	for i := 0; i < 5*1000; i++ {
+		simstore.Insert(fmt.Sprintf("%016x", r.Int63()), int64(i))
+	}
+
+	report := simstore.Report()
+
+	keys, nodes := simstore.Stats()
+	if report.Keys != keys || report.Nodes != nodes {
+		t.Errorf("Report has %d keys and %d nodes, Stats says %d and %d", report.Keys, report.Nodes, keys, nodes)
+	}
+	if report.Depth != 1 || len(report.Levels) != 2 {
+		t.Errorf("Expected 2 levels, got %+v", report.Levels)
+	}
+	if report.Levels[0].Nodes != 1 || report.Levels[1].Leaves != report.Leaves {
+		t.Errorf("Unexpected levels %+v", report.Levels)
+	}
+	if report.LargestLeaves[0].Keys < report.SmallestLeaves[0].Keys {
+		t.Error("Largest leaf is smaller than the smallest one")
+	}
+	if report.Levels[0].Skew > 0.1 {
+		t.Errorf("Random keys should not be skewed: %f", report.Levels[0].Skew)
+	}
+	if len(report.Warnings) != 0 {
+		t.Errorf("Unexpected warnings %v", report.Warnings)
+	}
+
+	// the same store gives the same report
+	again := simstore.Report()
+	if report.String() != again.String() {
+		t.Error("Text report is not deterministic")
+	}
+	a, _ := report.JSON()
+	b, _ := again.JSON()
+	if string(a) != string(b) {
+		t.Error("JSON report is not deterministic")
+	}
+	var decoded StoreReport
+	if err := json.Unmarshal(a, &decoded); err != nil || decoded.Keys != keys {
+		t.Errorf("JSON report doesn't decode: %v", err)
+	}
+}
+
+func TestReportChain(t *testing.T) {
+
+	simstore := NewSimStore()
+
+	// all keys share the lowest 2 bytes, so the first levels only have 1 subtree each
+	r := rand.New(rand.NewSource(2601))
+	for i := 0; i < 2*1000; i++ {
+		simstore.InsertHash(uint64(r.Int63())<<16|0xbeef, int64(i))
+	}
+
+	report := simstore.Report()
+	if report.LongestChain != 2 {
+		t.Errorf("Expected a chain of 2, got %d", report.LongestChain)
+	}
+	if report.Levels[0].Skew != 1 || report.Levels[0].TopByte != 0xef {
+		t.Errorf("Level 0 should be completely skewed towards 0xef: %+v", report.Levels[0])
+	}
+	if len(report.Warnings) == 0 || !strings.Contains(report.String(), "chain of 2 nodes") {
+		t.Errorf("Chain was not flagged: %s", report)
+	}
+	if report.LargestLeaves[0].Level != 3 || !strings.HasPrefix(report.LargestLeaves[0].Path, "ef/be/") {
+		t.Errorf("Unexpected largest leaf %+v", report.LargestLeaves[0])
+	}
+}
@@ -0,0 +1,155 @@
+package simhashing
+
+import "fmt"
+import "math/bits"
+import "strings"
+
+// Rolling shingles: the shingle length is a magic 3 in SimHash, and longer shingles cost more
+// to hash the usual way since every byte gets hashed once for every shingle it's in. A rolling
+// hash takes the oldest value out of the window and the new one in, so every step costs the
+// same whatever the window. Windows can be bytes or words (whatever strings.Fields says).
+
+// the units a rolling tokenizer slides its window over, as one 64 bit value each
+var rolling_tokenizers = map[string]func(text string, feed func(v uint64)){
+	"bytes": func(text string, feed func(uint64)) {
+		for i := 0; i < len(text); i++ {
+			feed(buz_table[text[i]])
+		}
+	},
+	"words": func(text string, feed func(uint64)) {
+		for _, word := range strings.Fields(text) {
+			feed(XXH64(word))
+		}
+	},
+}
+
+var rolling_hashes = map[string]bool{"buzhash": true, "rabinkarp": true}
+
+// a random value for every byte. These are part of every fingerprint made with the "bytes"
+// tokenizer, so they can't ever change.
+var buz_table [256]uint64
+
+func init() {
+	x := uint64(0)
+	for i := range buz_table {
+		x, buz_table[i] = splitmix64(x)
+	}
+
+	for _, a := range []Algorithm{
+		{ID: "simhash64-bytes7-buzhash-uniform-v1", Tokenizer: "bytes", TokenHash: "buzhash", Window: 7, Weighting: "uniform", Width: 64},
+		{ID: "simhash64-words4-buzhash-uniform-v1", Tokenizer: "words", TokenHash: "buzhash", Window: 4, Weighting: "uniform", Width: 64},
+	} {
+		if err := RegisterAlgorithm(a); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// returns the next state and a random number
+func splitmix64(state uint64) (uint64, uint64) {
+
+	state += 0x9e3779b97f4a7c15
+	z := state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+
+	return state, z ^ (z >> 31)
+}
+
+// the murmur3 finalizer, mixes every bit into every other bit
+func fmix64(k uint64) uint64 {
+
+	k ^= k >> 33
+	k *= 0xff51afd7ed558ccd
+	k ^= k >> 33
+	k *= 0xc4ceb9fe1a85ec53
+	k ^= k >> 33
+
+	return k
+}
+
+// any odd number works
+const rabin_base = 1099511628211
+
+// A hash of the last window values rolled in, updated in constant time.
+//
+// buzhash: the XOR of every value rotated by how far it is from the end of the window
+// rabinkarp: the sum of every value times rabin_base to the power of how far it is from the
+// end, mod 2^64.
+// Both get an fmix64 before voting: the low bits of rabinkarp only depend on the low bits of
+// the values, and a short buzhash window is just a few values XORed together.
+type roller struct {
+	window int
+	rabin  bool
+	ring   []uint64 // the last window values, ring[pos] is the oldest
+	pos    int
+	n      int // values rolled in so far
+	h      uint64
+	pow    uint64 // rabin_base^window, to take the oldest value out again
+}
+
+func new_roller(window int, rabin bool) *roller {
+
+	r := &roller{window: window, rabin: rabin, ring: make([]uint64, window), pow: 1}
+	for i := 0; i < window; i++ {
+		r.pow *= rabin_base
+	}
+
+	return r
+}
+
+// adds v to the window and takes out the value that falls off the other end
+func (r *roller) roll(v uint64) {
+
+	old := r.ring[r.pos] // 0 while the window isn't full yet, which takes out nothing
+	r.ring[r.pos] = v
+	r.pos++
+	if r.pos == r.window {
+		r.pos = 0
+	}
+	r.n++
+
+	if r.rabin {
+		r.h = r.h*rabin_base + v - old*r.pow
+	} else {
+		r.h = bits.RotateLeft64(r.h, 1) ^ bits.RotateLeft64(old, r.window) ^ v
+	}
+}
+
+// the hash of what's in the window
+func (r *roller) sum() uint64 {
+
+	return fmix64(r.h)
+}
+
+// rolling tokenizer -> rolling hash -> votes
+func rolling_counts(a Algorithm) (func(string) [64]int, error) {
+
+	feed := rolling_tokenizers[a.Tokenizer]
+	if !rolling_hashes[a.TokenHash] {
+		return nil, fmt.Errorf("simhashing: algorithm %q: tokenizer %q needs a rolling hash (buzhash or rabinkarp), not %q", a.ID, a.Tokenizer, a.TokenHash)
+	}
+	if a.Window < 1 {
+		return nil, fmt.Errorf("simhashing: algorithm %q: tokenizer %q needs a window", a.ID, a.Tokenizer)
+	}
+
+	window, rabin := a.Window, a.TokenHash == "rabinkarp"
+	return func(text string) [64]int {
+
+		var c bit_counter
+		r := new_roller(window, rabin)
+		feed(text, func(v uint64) {
+			r.roll(v)
+			if r.n >= window {
+				c.add(r.sum())
+			}
+		})
+
+		// shorter than a window: all of it is the one shingle, like in Tokenize_stride
+		if r.n > 0 && r.n < window {
+			c.add(r.sum())
+		}
+
+		return c.counts()
+	}, nil
+}
@@ -0,0 +1,119 @@
+package simhashing
+
+import "testing"
+import "fmt"
+import "math/bits"
+import "math/rand"
+import "strings"
+
+func TestRoller(t *testing.T) {
+
+	r := rand.New(rand.NewSource(4711))
+	values := make([]uint64, 300)
+	for i := range values {
+		values[i] = r.Uint64()
+	}
+
+	for _, window := range []int{1, 3, 7, 64, 65} {
+		buz, rabin := new_roller(window, false), new_roller(window, true)
+		for i, v := range values {
+			buz.roll(v)
+			rabin.roll(v)
+			if i+1 < window {
+				continue
+			}
+
+			// the same hashes from scratch
+			var expected_buz, expected_rabin uint64
+			for _, v := range values[i+1-window : i+1] {
+				expected_buz = bits.RotateLeft64(expected_buz, 1) ^ v
+				expected_rabin = expected_rabin*rabin_base + v
+			}
+			if buz.sum() != fmix64(expected_buz) {
+				t.Fatalf("Window %d: buzhash after %d values is %016x, expected %016x", window, i+1, buz.sum(), fmix64(expected_buz))
+			}
+			if rabin.sum() != fmix64(expected_rabin) {
+				t.Fatalf("Window %d: rabinkarp after %d values is wrong", window, i+1)
+			}
+		}
+	}
+}
+
+func TestRollingAlgorithms(t *testing.T) {
+
+	bytes7, _ := LookupAlgorithm("simhash64-bytes7-buzhash-uniform-v1")
+	words4, _ := LookupAlgorithm("simhash64-words4-buzhash-uniform-v1")
+
+	// pinned like the golden vectors
+	text := "It was the best of times, it was the worst of times,"
+	if h := bytes7.Hash(text); h != 0x644828e941f7da84 {
+		t.Errorf("bytes7 hash changed: %016x", h)
+	}
+	if h := words4.Hash(text); h != 0x8be936377a938283 {
+		t.Errorf("words4 hash changed: %016x", h)
+	}
+
+	if words4.Hash(text) != words4.Hash("  It was the\tbest of times,\nit was   the worst of times, ") {
+		t.Error("Word shingles should ignore whitespace")
+	}
+	if d := hamming_distance(bytes7.Hash(text), bytes7.Hash(text+" it was the age of wisdom")); d > 20 {
+		t.Errorf("Appending a bit moved %d bits", d)
+	}
+
+	for _, a := range []Algorithm{
+		{ID: "no-rolling-hash", Tokenizer: "bytes", TokenHash: "strong64", Window: 5, Weighting: "uniform", Width: 64},
+		{ID: "no-window", Tokenizer: "words", TokenHash: "buzhash", Weighting: "uniform", Width: 64},
+		{ID: "window-not-rolling", Tokenizer: "shingle3", TokenHash: "strong64", Window: 5, Weighting: "uniform", Width: 64},
+	} {
+		if err := RegisterAlgorithm(a); err == nil {
+			t.Errorf("Registering %s should fail", a.ID)
+		}
+	}
+}
+
+func TestRollingStore(t *testing.T) {
+
+	const id = "test-bytes9-rabinkarp"
+	if _, ok := LookupAlgorithm(id); !ok {
+		if err := RegisterAlgorithm(Algorithm{ID: id, Tokenizer: "bytes", TokenHash: "rabinkarp", Window: 9, Weighting: "uniform", Width: 64}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	simstore, err := NewSimStoreWithAlgorithm(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := rand.New(rand.NewSource(99))
+	for i := 0; i < 1000; i++ {
+		simstore.Insert(fmt.Sprintf("%016x%016x", r.Int63(), r.Int63()), int64(i))
+	}
+	text := strings.Repeat("It was the best of times, it was the worst of times, ", 4)
+	simstore.Insert(text, -1)
+
+	found, _, _ := simstore.Find(strings.Replace(text, "worst", "wurst", 1), 6)
+	if len(found) != 1 || found[0] != -1 {
+		t.Errorf("Expected to find the near-duplicate, got %v", found)
+	}
+}
+
+// the cost per byte shouldn't depend on the window
+func BenchmarkRollingWindow(b *testing.B) {
+
+	r := rand.New(rand.NewSource(45342))
+	var text strings.Builder
+	for text.Len() < 64*1024 {
+		fmt.Fprintf(&text, "%016x ", r.Int63())
+	}
+	src := text.String()
+
+	for _, window := range []int{3, 9, 32} {
+		counts, _ := rolling_counts(Algorithm{Tokenizer: "bytes", TokenHash: "buzhash", Window: window})
+		b.Run(fmt.Sprintf("bytes%d", window), func(b *testing.B) {
+			b.SetBytes(int64(len(src)))
+			for i := 0; i < b.N; i++ {
+				counts(src)
+			}
+		})
+	}
+}
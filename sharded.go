@@ -0,0 +1,299 @@
+package simhashing
+
+import "context"
+import "sync"
+
+// How a ShardedSimStore decides which shard an item goes to
+type ShardBy int
+
+const (
+	ShardByHash ShardBy = iota // use the high bits of the simhash (the trie splits on the low ones)
+	ShardById                  // use ranges of ids
+)
+
+// the trie splits on the LSBs first, so the top bits are the least correlated with the tree shape
+const shard_hash_bits = 16
+
+// A SimStore split into a number of independent SimStores, each with its own lock
+// so inserts don't all funnel through one root. Queries go to all shards concurrently
+// and the results get merged.
+type ShardedSimStore struct {
+	mu       sync.RWMutex // protects shards (only Rebalance changes it)
+	shards   []*shard
+	by       ShardBy
+	id_range int64 // how many consecutive ids go in the same shard (ShardById only)
+
+	algorithm *Algorithm // every shard uses this one too, nil means DefaultAlgorithm
+}
+
+type shard struct {
+	mu    sync.RWMutex
+	store *SimStore
+}
+
+// Creates a new ShardedSimStore with n shards (at least 1), partitioned by the high bits of the hash.
+func NewShardedSimStore(n int) *ShardedSimStore {
+	return &ShardedSimStore{shards: make_shards(n, nil), by: ShardByHash}
+}
+
+// Creates a new ShardedSimStore with n shards where every id_range consecutive ids share a shard.
+// Handy if ids are sequential and you want to be able to drop/rebuild a range at a time.
+func NewShardedSimStoreById(n int, id_range int64) *ShardedSimStore {
+	if id_range < 1 {
+		id_range = 1
+	}
+	return &ShardedSimStore{shards: make_shards(n, nil), by: ShardById, id_range: id_range}
+}
+
+// Same as NewShardedSimStore, but fingerprints text with a registered algorithm.
+// Fails with ErrUnknownAlgorithm if there is no algorithm with that id.
+func NewShardedSimStoreWithAlgorithm(n int, id string) (*ShardedSimStore, error) {
+	return NewShardedSimStore(n).with_algorithm(id)
+}
+
+// Same as NewShardedSimStoreById, but fingerprints text with a registered algorithm.
+func NewShardedSimStoreByIdWithAlgorithm(n int, id_range int64, id string) (*ShardedSimStore, error) {
+	return NewShardedSimStoreById(n, id_range).with_algorithm(id)
+}
+
+// sets the algorithm on a new (empty) store and all its shards
+func (ss *ShardedSimStore) with_algorithm(id string) (*ShardedSimStore, error) {
+
+	// NewSimStoreWithAlgorithm knows which ids exist and leaves the default nil
+	s, err := NewSimStoreWithAlgorithm(id)
+	if err != nil {
+		return nil, err
+	}
+
+	ss.algorithm = s.algorithm
+	ss.shards = make_shards(len(ss.shards), ss.algorithm)
+	return ss, nil
+}
+
+// Returns the algorithm this store fingerprints text with
+func (ss *ShardedSimStore) Algorithm() Algorithm {
+
+	if ss.algorithm == nil {
+		return *lookup_algorithm(DefaultAlgorithm)
+	}
+	return *ss.algorithm
+}
+
+// the fingerprint of text in this store, same as SimStore.hash
+func (ss *ShardedSimStore) hash(text string) uint64 {
+
+	if ss.algorithm == nil {
+		return SimHash(text)
+	}
+	return ss.algorithm.Hash(text)
+}
+
+func make_shards(n int, algorithm *Algorithm) []*shard {
+
+	if n < 1 {
+		n = 1
+	}
+
+	shards := make([]*shard, n)
+	for i := range shards {
+		shards[i] = &shard{store: &SimStore{algorithm: algorithm}}
+	}
+
+	return shards
+}
+
+// which shard (out of n) an item lives in
+func (ss *ShardedSimStore) shard_for(item entry, n int) int {
+
+	if ss.by == ShardById {
+		// floor division: / rounds towards zero, which would make -id_range+1 ... id_range-1 one range
+		r := item.id / ss.id_range
+		if item.id%ss.id_range < 0 {
+			r--
+		}
+		// negative ids are allowed, keep the index positive
+		i := r % int64(n)
+		if i < 0 {
+			i += int64(n)
+		}
+		return int(i)
+	}
+
+	return int((item.key >> (64 - shard_hash_bits)) % uint64(n))
+}
+
+// Returns the number of shards
+func (ss *ShardedSimStore) Shards() int {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	return len(ss.shards)
+}
+
+// Inserts a new value in the store
+func (ss *ShardedSimStore) Insert(text string, id int64) {
+	ss.insert(entry{key: ss.hash(text), id: id})
+}
+
+func (ss *ShardedSimStore) insert(item entry) {
+
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	sh := ss.shards[ss.shard_for(item, len(ss.shards))]
+	sh.mu.Lock()
+	sh.store.insert(item)
+	sh.mu.Unlock()
+}
+
+// runs fn on every shard at the same time (holding that shard's read lock) and waits for all of them
+// the caller must hold ss.mu so the shards don't change underneath us
+func (ss *ShardedSimStore) fan_out(fn func(i int, s *SimStore)) {
+
+	var wg sync.WaitGroup
+	for i, sh := range ss.shards {
+		wg.Add(1)
+		go func(i int, sh *shard) {
+			defer wg.Done()
+			sh.mu.RLock()
+			defer sh.mu.RUnlock()
+			fn(i, sh.store)
+		}(i, sh)
+	}
+	wg.Wait()
+}
+
+// returns true if target is present in any of the shards
+func (ss *ShardedSimStore) Contains(text string) (present bool, index int64) {
+
+	target := ss.hash(text)
+
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	// with hash sharding only one shard can have it
+	if ss.by == ShardByHash {
+		sh := ss.shards[ss.shard_for(entry{key: target}, len(ss.shards))]
+		sh.mu.RLock()
+		defer sh.mu.RUnlock()
+		return sh.store.contains(target)
+	}
+
+	ids := make([]int64, len(ss.shards))
+	hits := make([]bool, len(ss.shards))
+
+	ss.fan_out(func(i int, s *SimStore) {
+		hits[i], ids[i] = s.contains(target)
+	})
+
+	// lowest shard wins so the answer doesn't depend on scheduling
+	for i, hit := range hits {
+		if hit {
+			return true, ids[i]
+		}
+	}
+
+	return false, -1
+}
+
+// returns all the ids with a Hamming Distance of distance or less, from all shards
+// as well as the number of keys and nodes checked in total
+func (ss *ShardedSimStore) Find(text string, distance uint8) (found []int64, keys_checked int, nodes_checked int) {
+
+	target := ss.hash(text)
+
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	n := len(ss.shards)
+
+	type result struct {
+		found []int64
+		keys  int
+		nodes int
+	}
+	results := make([]result, n)
+
+	ss.fan_out(func(i int, s *SimStore) {
+		f, k, n := s.find(target, distance)
+		results[i] = result{f, k, n}
+	})
+
+	found = make([]int64, 0)
+	for _, r := range results {
+		found = append(found, r.found...)
+		keys_checked += r.keys
+		nodes_checked += r.nodes
+	}
+
+	return
+}
+
+// Find the closest thing matching the input over all shards
+// returns -1 if the store is empty
+func (ss *ShardedSimStore) FindClosest(text string) int64 {
+
+	target := ss.hash(text)
+
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	// find_nearest rather than find_closest: that one prints its progress, which is a mess
+	// with all shards doing it at once
+	closest := make([][]Match, len(ss.shards))
+	ss.fan_out(func(i int, s *SimStore) {
+		closest[i] = s.find_nearest(target, 1, new_query(context.Background(), Budget{}))
+	})
+
+	// lowest distance wins, ties go to the lowest id so the answer doesn't depend on the shards
+	// (a single SimStore.FindClosest returns whichever of those its search reaches first)
+	best := []Match{}
+	for _, m := range closest {
+		if len(m) > 0 {
+			best = add_match(best, m[0], 1)
+		}
+	}
+	if len(best) == 0 {
+		return -1
+	}
+
+	return best[0].Id
+}
+
+// return the number of keys and nodes in all the shards
+func (ss *ShardedSimStore) Stats() (keys, nodes int) {
+
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	n := len(ss.shards)
+
+	counts := make([][2]int, n)
+	ss.fan_out(func(i int, s *SimStore) {
+		counts[i][0], counts[i][1] = s.Stats()
+	})
+
+	for _, c := range counts {
+		keys += c[0]
+		nodes += c[1]
+	}
+
+	return
+}
+
+// Redistributes everything over n new shards
+// This blocks all other operations while it runs
+func (ss *ShardedSimStore) Rebalance(n int) {
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	shards := make_shards(n, ss.algorithm)
+	for _, old := range ss.shards {
+		old.mu.Lock()
+		old.store.walk(func(item entry) {
+			shards[ss.shard_for(item, len(shards))].store.insert(item)
+		})
+		old.mu.Unlock()
+	}
+
+	ss.shards = shards
+}
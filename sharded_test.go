@@ -0,0 +1,195 @@
+package simhashing
+
+import "testing"
+import "errors"
+import "fmt"
+import "math/rand"
+import "sort"
+import "sync"
+
+// a sharded store should give the same answers as a single one
+func TestShardedFind(t *testing.T) {
+
+	simstore := NewSimStore()
+	sharded := NewShardedSimStore(4)
+
+	r := rand.New(rand.NewSource(2121))
+	for i := 0; i < 5*1000; i++ {
+		text := fmt.Sprintf("%016x", r.Int63())
+		simstore.Insert(text, int64(i))
+		sharded.Insert(text, int64(i))
+	}
+
+	for i := 0; i < 20; i++ {
+		query := fmt.Sprintf("%016x", r.Int63())
+		expected, _, _ := simstore.Find(query, 10)
+		found, _, _ := sharded.Find(query, 10)
+		if !int64array_sameset(expected, found) {
+			t.Errorf("Sharded Find returned %v, expected %v", found, expected)
+		}
+	}
+
+	keys, _ := simstore.Stats()
+	sharded_keys, _ := sharded.Stats()
+	if keys != sharded_keys {
+		t.Errorf("Sharded Stats has %d keys, expected %d", sharded_keys, keys)
+	}
+}
+
+func TestShardedFindClosest(t *testing.T) {
+
+	sharded := NewShardedSimStoreById(3, 100)
+
+	if sharded.FindClosest("anything") != -1 {
+		t.Error("FindClosest on an empty store should return -1")
+	}
+
+	r := rand.New(rand.NewSource(1234))
+	keys := make(map[int64]uint64)
+	for i := 0; i < 2*1000; i++ {
+		text := fmt.Sprintf("%016x", r.Int63())
+		sharded.Insert(text, int64(i))
+		keys[int64(i)] = SimHash(text)
+	}
+
+	// no exact match: has to be as close as the closest one by brute force
+	target := SimHash("it was the age of wisdom, it was the age of foolishness,")
+	best := uint8(64)
+	for _, key := range keys {
+		best = min(best, hamming_distance(key, target))
+	}
+	if id := sharded.FindClosest("it was the age of wisdom, it was the age of foolishness,"); hamming_distance(keys[id], target) != best {
+		t.Errorf("FindClosest found id %d at distance %d, the closest is %d", id, hamming_distance(keys[id], target), best)
+	}
+
+	sharded.Insert("It was the best of times, it was the worst of times,", 555555)
+	if sharded.FindClosest("It was the best of times, it was the worst of times,") != 555555 {
+		t.Error("FindClosest didn't find the perfect match")
+	}
+
+	present, id := sharded.Contains("It was the best of times, it was the worst of times,")
+	if !present || id != 555555 {
+		t.Errorf("Contains returned %v, %d", present, id)
+	}
+}
+
+func TestShardedRebalance(t *testing.T) {
+
+	sharded := NewShardedSimStore(2)
+
+	r := rand.New(rand.NewSource(99))
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				sharded.Insert(fmt.Sprintf("%d-%d", g, i), int64(g*1000+i))
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	query := fmt.Sprintf("%016x", r.Int63())
+	before, _, _ := sharded.Find(query, 16)
+
+	sharded.Rebalance(7)
+	if sharded.Shards() != 7 {
+		t.Errorf("Expected 7 shards, got %d", sharded.Shards())
+	}
+
+	keys, _ := sharded.Stats()
+	if keys != 4*500 {
+		t.Errorf("Rebalance lost keys: have %d", keys)
+	}
+
+	after, _, _ := sharded.Find(query, 16)
+	if !int64array_sameset(before, after) {
+		t.Errorf("Find after Rebalance returned %v, expected %v", after, before)
+	}
+}
+
+// check that 2 arrays of ints have the same contents, ignoring order
+func int64array_sameset(a []int64, b []int64) bool {
+
+	if len(a) != len(b) {
+		return false
+	}
+
+	a = append([]int64(nil), a...)
+	b = append([]int64(nil), b...)
+	sort.Slice(a, func(i, j int) bool { return a[i] < a[j] })
+	sort.Slice(b, func(i, j int) bool { return b[i] < b[j] })
+
+	for i := 0; i < len(a); i++ {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestShardedAlgorithm(t *testing.T) {
+
+	if _, err := NewShardedSimStoreWithAlgorithm(4, "no-such-algorithm"); !errors.Is(err, ErrUnknownAlgorithm) {
+		t.Errorf("Expected ErrUnknownAlgorithm, got %v", err)
+	}
+
+	const id = "simhash64-shingle3-xxh64-uniform-v1"
+	sharded, err := NewShardedSimStoreByIdWithAlgorithm(4, 10, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := rand.New(rand.NewSource(1234))
+	for i := 0; i < 1000; i++ {
+		sharded.Insert(fmt.Sprintf("%016x", r.Int63()), int64(i))
+	}
+	text := "It was the best of times, it was the worst of times,"
+	sharded.Insert(text, 555555)
+	sharded.Rebalance(3)
+
+	if sharded.Algorithm().ID != id {
+		t.Errorf("Store uses %s", sharded.Algorithm().ID)
+	}
+	for _, sh := range sharded.shards {
+		if sh.store.Algorithm().ID != id {
+			t.Errorf("Shard uses %s", sh.store.Algorithm().ID)
+		}
+	}
+
+	// everything has to agree on the hash for these to work
+	if present, id := sharded.Contains(text); !present || id != 555555 {
+		t.Errorf("Contains returned %v, %d", present, id)
+	}
+	if found, _, _ := sharded.Find(text, 0); len(found) != 1 || found[0] != 555555 {
+		t.Errorf("Find returned %v", found)
+	}
+	if sharded.FindClosest(text) != 555555 {
+		t.Error("FindClosest didn't find the perfect match")
+	}
+	if SimHashWith(text, XXH64) == SimHash(text) {
+		t.Error("the algorithms should differ for this test to mean anything")
+	}
+}
+
+func TestShardByIdRanges(t *testing.T) {
+
+	ss := NewShardedSimStoreById(4, 10)
+
+	// every range is id_range ids wide, also around 0, and consecutive ranges go to consecutive shards
+	for id := int64(-45); id < 45; id++ {
+		floor := id / 10
+		if id < 0 && id%10 != 0 {
+			floor--
+		}
+		expected := int(((floor % 4) + 4) % 4)
+		if got := ss.shard_for(entry{id: id}, 4); got != expected {
+			t.Errorf("id %d went to shard %d, expected %d", id, got, expected)
+		}
+	}
+	if ss.shard_for(entry{id: -1}, 4) == ss.shard_for(entry{id: 1}, 4) {
+		t.Error("-1 and 1 should be in different ranges")
+	}
+}
@@ -5,6 +5,10 @@ package simhashing
 
 import "fmt"
 import "container/heap"
+import "context"
+import "math/bits"
+import "sort"
+import "time"
 
 const bit_length = 8
 const size = 1 << bit_length
@@ -19,6 +23,7 @@ var level_chunks = [...]uint64{
 	0xff << 16,
 	0xff << 24,
 	0xff << 32,
+	0xff << 40,
 	0xff << 48,
 	0xff << 56,
 }
@@ -34,6 +39,7 @@ var masks = [...]uint64{
 	0xffffff0000000000,
 	0xffff000000000000,
 	0xff00000000000000,
+	0x0000000000000000, // below the last level every bit has been matched
 }
 
 // BTW: stuff is uint8 since that saves space
@@ -73,31 +79,21 @@ func init() {
 	//fmt.Println(distance_table)
 }
 
-// calculate HDs using a table lookup
-// todo: check if this is actually faster than the one in util
-// (I think it is, but not much)
-func hamming_distance(a uint64, b uint64) (distance uint8) {
-
-	distance = 0
-
-	var a_chunk, b_chunk uint8
-	// a>0 || b>0 in this case a^b is sufficient since 0 means a=b=0 or a==b which makes their distance 0 :)
-	for a^b != 0 {
-
-		a_chunk = uint8((size - 1) & a)
-		b_chunk = uint8((size - 1) & b)
-		distance += hamming[a_chunk][b_chunk]
-		a = a >> bit_length
-		b = b >> bit_length
-	}
-
-	return
+// calculate HDs
+// this used to be a table lookup per byte, but the popcount instruction is a lot faster
+// (see BenchmarkHammingDistance*), the table is still what we use per level in the tree
+func hamming_distance(a uint64, b uint64) uint8 {
+	return uint8(bits.OnesCount64(a ^ b))
 }
 
 type SimStore struct {
-	values []entry
-	nodes  map[uint8]*SimStore // all subtrees based on the first bits_per_key LSB (maybe mae this an array, maybe faster?)
-	level  uint8               // determines which bitrange we pick to split keys into nodes
+	values   []entry
+	nodes    map[uint8]*SimStore // all subtrees based on the first bits_per_key LSB (maybe mae this an array, maybe faster?)
+	level    uint8               // determines which bitrange we pick to split keys into nodes
+	num_keys int                 // number of keys in this node and all subtrees
+	metrics  *Metrics            // nil unless SetMetrics was called, shared by all nodes
+
+	algorithm *Algorithm // only set on the root, nil means DefaultAlgorithm
 }
 
 type entry struct {
@@ -112,12 +108,21 @@ func NewSimStore() *SimStore {
 
 // Inserts a new value in the store
 func (s *SimStore) Insert(text string, id int64) {
-	s.insert(entry{key: SimHash(text), id: id})
+	s.insert(entry{key: s.hash(text), id: id})
+	s.metrics.inserted()
+}
+
+// Inserts an already computed hash in the store
+func (s *SimStore) InsertHash(key uint64, id int64) {
+	s.insert(entry{key: key, id: id})
+	s.metrics.inserted()
 }
 
 // inserts a new value in the store, doesn't rehash etc
 func (s *SimStore) insert(item entry) {
 
+	s.num_keys++
+
 	if len(s.nodes) > 0 {
 
 		// get the byte for this level
@@ -125,33 +130,78 @@ func (s *SimStore) insert(item entry) {
 		//		fmt.Printf("Node insert: level %d, getting byte: 0b%064b & 0b%064b = 0b%08b (%d)\n", s.level, level_chunks[ s.level ], item.key, b, b)
 		_, exists := s.nodes[b]
 		if !exists {
-			s.nodes[b] = &SimStore{level: s.level + 1}
+			s.nodes[b] = &SimStore{level: s.level + 1, metrics: s.metrics}
+			s.metrics.nodes_changed(1)
 		}
 		s.nodes[b].insert(item)
 	} else {
 		s.values = append(s.values, item)
-		if len(s.values) > max_keys_per_node { // different constant here would be better I think
+		// a leaf below the last level has used up every byte of the key, so everything in it is
+		// the same key: splitting won't help, duplicates just pile up there
+		if len(s.values) > max_keys_per_node && int(s.level) < len(level_chunks) { // different constant here would be better I think
 			s.split()
 		}
 	}
 
 }
 
+// Removes the item for text with this id, returns false if it wasn't in the store
+func (s *SimStore) Delete(text string, id int64) bool {
+	deleted := s.remove(entry{key: s.hash(text), id: id})
+	if deleted {
+		s.metrics.deleted()
+	}
+	return deleted
+}
+
+// removes an item, nodes that end up empty are dropped
+// (we never merge small nodes back into their parent though)
+func (s *SimStore) remove(item entry) bool {
+
+	if len(s.nodes) > 0 {
+		b := uint8((level_chunks[s.level] & item.key) >> (s.level * bits_per_key)) // this gets you the Nth byte
+		subtree, exists := s.nodes[b]
+		if !exists || !subtree.remove(item) {
+			return false
+		}
+		if len(subtree.nodes) == 0 && len(subtree.values) == 0 {
+			delete(s.nodes, b)
+			s.metrics.nodes_changed(-1)
+		}
+		s.num_keys--
+		return true
+	}
+
+	for i, v := range s.values {
+		if v == item {
+			s.values = append(s.values[:i], s.values[i+1:]...)
+			s.num_keys--
+			return true
+		}
+	}
+
+	return false
+}
+
 // go ever every key and put it in a node based on the value of its Nth byte
 func (s *SimStore) split() {
 
+	s.metrics.split()
 	s.nodes = make(map[uint8]*SimStore, size)
 
 	for _, item := range s.values {
 		b := uint8((level_chunks[s.level] & item.key) >> (s.level * bits_per_key)) // this gets you the Nth byte
 		_, exists := s.nodes[b]
 		if !exists {
-			s.nodes[b] = &SimStore{level: s.level + 1}
+			s.nodes[b] = &SimStore{level: s.level + 1, metrics: s.metrics}
 		}
 		// don't bother with Insert(), we are splitting so we'll always be adding to the keys at this point
 		s.nodes[b].values = append(s.nodes[b].values, item)
+		s.nodes[b].num_keys++
 	}
 
+	s.metrics.nodes_changed(len(s.nodes))
+
 	// we don't need our values anymore
 	s.values = s.values[0:0]
 
@@ -167,8 +217,8 @@ func (s *SimStore) pretty(indent string) string {
 
 	if len(s.nodes) > 0 {
 		out += fmt.Sprintf("%slevel % 2d\n", indent, s.level)
-		for index, node := range s.nodes {
-			out += fmt.Sprintf("%s%03d: %s", indent, index, node.pretty(indent+"   "))
+		for _, index := range s.prefixes() {
+			out += fmt.Sprintf("%s%03d: %s", indent, index, s.nodes[index].pretty(indent+"   "))
 		}
 	} else {
 		return fmt.Sprintf("%skeys [%d/%d]\n", indent, len(s.values), size)
@@ -177,6 +227,18 @@ func (s *SimStore) pretty(indent string) string {
 	return out
 }
 
+// the bytes of our subtrees in increasing order (so output doesn't depend on map iteration order)
+func (s *SimStore) prefixes() []uint8 {
+
+	prefixes := make([]uint8, 0, len(s.nodes))
+	for prefix := range s.nodes {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return prefixes[i] < prefixes[j] })
+
+	return prefixes
+}
+
 // return the number of keys and nodes in the store
 func (s *SimStore) Stats() (keys, nodes int) {
 
@@ -192,9 +254,26 @@ func (s *SimStore) Stats() (keys, nodes int) {
 	return
 }
 
+// Returns the number of keys in the store (same as the keys from Stats, but without walking the tree)
+func (s *SimStore) Len() int {
+	return s.num_keys
+}
+
+// calls fn for every entry in the store (in no particular order)
+func (s *SimStore) walk(fn func(item entry)) {
+
+	for _, subtree := range s.nodes {
+		subtree.walk(fn)
+	}
+
+	for _, item := range s.values {
+		fn(item)
+	}
+}
+
 // returns true if target is present in the store
 func (s *SimStore) Contains(text string) (present bool, index int64) {
-	return s.contains(SimHash(text))
+	return s.contains(s.hash(text))
 }
 
 // returns true if target is present in the store
@@ -232,10 +311,9 @@ func (s *SimStore) FindScanAll(target uint64, distance uint8) (found []uint64) {
 			found = append(found, subtree.FindScanAll(target, distance)...)
 		}
 	} else {
-		for _, item := range s.values {
-			if hamming_distance(item.key, target) <= distance {
-				found = append(found, item.key)
-			}
+		var hits [max_keys_per_node + 1]int
+		for _, i := range entries_within(s.values, target, ^uint64(0), distance, hits[:0]) {
+			found = append(found, s.values[i].key)
 		}
 	}
 
@@ -247,73 +325,44 @@ func (s *SimStore) FindScanAll(target uint64, distance uint8) (found []uint64) {
 // returns the matches found as well as the number of keys and nodes checked
 func (s *SimStore) Find(text string, distance uint8) (found []int64, keys_checked int, nodes_checked int) {
 
-	return s.find(SimHash(text), distance)
+	return s.FindHash(s.hash(text), distance)
+}
+
+// Same as Find, but for an already computed hash
+func (s *SimStore) FindHash(target uint64, distance uint8) (found []int64, keys_checked int, nodes_checked int) {
+
+	start := time.Now()
+	found, keys_checked, nodes_checked = s.find(target, distance)
+	s.metrics.queried("find", start, keys_checked, nodes_checked)
+
+	return
 }
 
 // returns all the hashes with a Hamming Distance of distance or less
 // (less than or equal to make searching for 0 more natural)
 // returns the matches found as well as the number of keys and nodes checked
+// (this is find_query without limits, so there's only one walk to keep right)
 func (s *SimStore) find(target uint64, distance uint8) (found []int64, keys_checked int, nodes_checked int) {
 
+	q := new_query(context.Background(), Budget{})
 	found = make([]int64, 0)
-	b := int((level_chunks[s.level] & target) >> (s.level * bits_per_key)) // this gets you the Nth byte
-	//	fmt.Printf("Target 0b%064b, distance %02d, byte 0b%08b [%d]\n", target, distance, b, b)
-
-	if len(s.nodes) > 0 {
-
-		// for all bytes that are within distance (with a max of 8) we check all nodes
-		// since hamming_distance is additive
-		// example: looking for 101011 with distance 2
-		// we take the LSBs 11, and find everything that is within distance 2:
-		// (00, 10, 01, 11) and recurse:
-		// node[00].Find( 101011, 0 ) (already 'spent' distance 2)
-		// node[10].Find( 101011, 1)
-		// node[01].Find( 101011, 1)
-		// node[11].Find( 101011, 2) (distance for this subrange was 0, 2 left to 'spend')
-		//		fmt.Println(distance_table[b])
-
-		end := min(8, distance)
-		//		fmt.Printf("Searching from 0 to %03d\n", end)
-
-		for i := uint8(0); i <= end; i++ { // check everything withing distance range
-			//			fmt.Printf("Distance %d\n", i)
-			for _, d := range distance_table[b][i] { // lookup which bytes are that distance from us
-				subtree, exists := s.nodes[d] // check in those subtrees, if they exist
-				//				fmt.Printf("Checking byte 0b%08b - node exists: %v\n", d, exists)
-				if exists {
-					// recurse, but the distance gets smaller
-					f, k, n := subtree.find(target, distance-i)
-					keys_checked += k
-					nodes_checked += n
-					found = append(found, f...)
-				}
-			}
-		}
-
-		nodes_checked += len(s.nodes)
+	s.find_query(target, distance, q, &found)
 
-	} else {
-		// we need the part of the hash that has not been matched yet, so the (64 - bits_per_key*(level+1)) MSBs
-		// eg to get the top 12 bits we do 1<<12 (0b1000000000000), -1 (0b0111111111111), then shifted to the MSBs
-		// ehr, so let's just use a lookup ;)
-		//mask := ()(1 << (64 - bits_per_key*(s.level+1))) -1) << (64-s.level*bits_per_key)
-		mask := masks[s.level]
-		masked_target := target & mask
-		for _, item := range s.values {
-			if hamming_distance(item.key&mask, masked_target) <= distance {
-				found = append(found, item.id)
-			}
-		}
-		keys_checked += len(s.values)
-	}
-
-	return
+	return found, q.stats.KeysChecked, q.stats.NodesChecked
 }
 
 // Find the closest thing matching the input
 func (s *SimStore) FindClosest(text string) int64 {
 
-	target := SimHash(text)
+	start := time.Now()
+	_, closest := s.find_closest(s.hash(text))
+	s.metrics.queried("find_closest", start, -1, -1)
+
+	return closest
+}
+
+// finds the closest key to target, returns that key and its id
+func (s *SimStore) find_closest(target uint64) (best_key uint64, closest int64) {
 
 	fmt.Printf("FC 0b%064b\n", target)
 
@@ -344,8 +393,7 @@ func (s *SimStore) FindClosest(text string) int64 {
 
 	// first of all, do we even have nodes, bro?
 	if len(s.nodes) == 0 {
-		_, closest := find_closest_in_keys(&s.values, target)
-		return closest
+		return find_closest_in_keys(&s.values, target)
 	}
 
 	// the hard case is much much harder than the simple one unfortunately
@@ -365,10 +413,8 @@ func (s *SimStore) FindClosest(text string) int64 {
 	}
 
 	// then expand the shortest distance until we hit a key
-	var best_key uint64
-	var closest int64
 	paths_tried := 0
-	// TODO: the above might be better off as an entry type
+	// TODO: best_key and closest might be better off as an entry type
 
 	for sh.Len() > 0 {
 
@@ -400,7 +446,7 @@ func (s *SimStore) FindClosest(text string) int64 {
 
 	// if we found an exact match, we can skip everything else and just return that
 	if upper_bound == 0 {
-		return closest
+		return
 	}
 
 	fmt.Printf("Checking remaining nodes, upper bound is %d\n", upper_bound)
@@ -446,7 +492,100 @@ func (s *SimStore) FindClosest(text string) int64 {
 	fmt.Printf("Checked %d paths\n", paths_tried)
 
 	// so if we have any IDs with value 0, we're returning bad things
-	return closest
+	return
+}
+
+// A search result: the id of an item and how far it is from what we were looking for
+type Match struct {
+	Id       int64
+	Distance uint8
+}
+
+// Finds the k items closest to text (or fewer if the store doesn't have that many)
+// sorted by increasing distance
+func (s *SimStore) FindNearest(text string, k int) []Match {
+
+	start := time.Now()
+	q := new_query(context.Background(), Budget{})
+	nearest := s.find_nearest(s.hash(text), k, q)
+	s.metrics.queried("find_nearest", start, q.stats.KeysChecked, q.stats.NodesChecked)
+
+	return nearest
+}
+
+// same idea as find_closest(): expand the node with the smallest distance so far first,
+// but keep the k best keys and stop once no node can beat the worst of those
+// (or when q tells us to stop)
+func (s *SimStore) find_nearest(target uint64, k int, q *query) (nearest []Match) {
+
+	// k comes from users, don't allocate more than we could ever return
+	if k > s.num_keys {
+		k = s.num_keys
+	}
+	nearest = make([]Match, 0, k)
+	if k < 1 {
+		return
+	}
+
+	sh := &SearchHeap{}
+	heap.Init(sh)
+	heap.Push(sh, &Distance{hamming_distance: 0, subtree: s})
+
+	for sh.Len() > 0 {
+
+		shortest := heap.Pop(sh).(*Distance)
+
+		// the distance of a node is a lower bound for all keys in it
+		// (equal distances still get checked, they might have a lower id)
+		if len(nearest) == k && nearest[k-1].Distance < shortest.hamming_distance {
+			break
+		}
+		if q.stop(true) {
+			break
+		}
+
+		if len(shortest.subtree.nodes) == 0 {
+			for _, item := range shortest.subtree.values {
+				if q.stop(false) {
+					break
+				}
+				q.stats.KeysChecked++
+				nearest = add_match(nearest, Match{Id: item.id, Distance: hamming_distance(item.key, target)}, k)
+			}
+			continue
+		}
+
+		q.stats.NodesChecked += len(shortest.subtree.nodes)
+		b := uint8((level_chunks[shortest.subtree.level] & target) >> (shortest.subtree.level * bits_per_key)) // this gets you the Nth byte
+		for prefix, subtree := range shortest.subtree.nodes {
+			heap.Push(sh, &Distance{
+				hamming_distance: shortest.hamming_distance + hamming[b][prefix],
+				subtree:          subtree,
+			})
+		}
+	}
+
+	return
+}
+
+// insert m in the sorted list of matches, keeping at most k
+// ties are ordered by id so results don't depend on map iteration order
+func add_match(matches []Match, m Match, k int) []Match {
+
+	i := sort.Search(len(matches), func(i int) bool {
+		return matches[i].Distance > m.Distance || (matches[i].Distance == m.Distance && matches[i].Id > m.Id)
+	})
+	if i >= k {
+		return matches
+	}
+
+	if len(matches) < k {
+		matches = append(matches, Match{})
+	}
+	copy(matches[i+1:], matches[i:])
+	matches[i] = m
+
+	return matches
 }
 
 func find_closest_in_keys(v *[]entry, target uint64) (key uint64, closest int64) {
@@ -90,3 +90,137 @@ func BenchmarkInsert(b *testing.B) {
 
 	}
 }
+
+func BenchmarkFind(b *testing.B) {
+
+	simstore := NewSimStore()
+	r := rand.New(rand.NewSource(45342))
+	for i := 0; i < 100*1000; i++ {
+		simstore.InsertHash(uint64(r.Int63()), int64(i))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		simstore.FindHash(uint64(r.Int63()), 6)
+	}
+}
+
+func TestDelete(t *testing.T) {
+
+	simstore := NewSimStore()
+
+	r := rand.New(rand.NewSource(777))
+	for i := 0; i < 2*1000; i++ {
+		simstore.Insert(fmt.Sprintf("%016x", r.Int63()), int64(i))
+	}
+	simstore.Insert("It was the best of times, it was the worst of times,", -1)
+
+	if simstore.Delete("It was the best of times, it was the worst of times,", 3) {
+		t.Error("Delete removed something with the wrong id")
+	}
+	if !simstore.Delete("It was the best of times, it was the worst of times,", -1) {
+		t.Error("Delete didn't find the item")
+	}
+	if present, _ := simstore.Contains("It was the best of times, it was the worst of times,"); present {
+		t.Error("Item still present after Delete")
+	}
+
+	keys, _ := simstore.Stats()
+	if keys != 2*1000 || simstore.Len() != keys {
+		t.Errorf("Expected %d keys after Delete, got %d (Len %d)", 2*1000, keys, simstore.Len())
+	}
+}
+
+func TestDuplicateKeys(t *testing.T) {
+
+	simstore := NewSimStore()
+
+	// way more copies than fit in a node, these end up in a leaf below the last level
+	for i := 0; i < 1000; i++ {
+		simstore.Insert("same", int64(i))
+	}
+	simstore.Insert("different", -1)
+
+	if found, _, _ := simstore.Find("same", 0); len(found) != 1000 {
+		t.Errorf("Expected 1000 copies, found %d", len(found))
+	}
+	if nearest := simstore.FindNearest("same", 2000); len(nearest) != 1001 || nearest[0].Distance != 0 {
+		t.Errorf("FindNearest returned %d matches", len(nearest))
+	}
+	if !simstore.Delete("same", 500) || simstore.Len() != 1000 {
+		t.Error("Delete of a duplicate failed")
+	}
+	if report := simstore.Report(); report.Depth != len(level_chunks) || len(report.Warnings) == 0 {
+		t.Errorf("Report has depth %d and warnings %v", report.Depth, report.Warnings)
+	}
+}
+
+func TestAllLevels(t *testing.T) {
+
+	simstore := NewSimStore()
+
+	// keys that only differ in the top 3 bytes fill the tree down to level 5 and below,
+	// which only works if every level looks at its own byte
+	r := rand.New(rand.NewSource(777))
+	keys := make([]uint64, 5*1000)
+	for i := range keys {
+		keys[i] = 0x0000001234567890 | uint64(r.Int63())<<40
+		simstore.InsertHash(keys[i], int64(i))
+	}
+
+	for i, key := range keys[:100] {
+		found, _, _ := simstore.FindHash(key, 0)
+		for _, id := range found {
+			if keys[id] != key {
+				t.Errorf("Find of key %d with distance 0 found %016x", i, keys[id])
+			}
+		}
+		if len(found) == 0 {
+			t.Errorf("Find of key %d found nothing", i)
+		}
+	}
+}
+
+func TestFindNearest(t *testing.T) {
+
+	simstore := NewSimStore()
+
+	if len(simstore.FindNearest("anything", 3)) != 0 {
+		t.Error("FindNearest on an empty store should not return anything")
+	}
+
+	r := rand.New(rand.NewSource(4321))
+	keys := make(map[int64]uint64)
+	for i := 0; i < 5*1000; i++ {
+		text := fmt.Sprintf("%016x", r.Int63())
+		simstore.Insert(text, int64(i))
+		keys[int64(i)] = SimHash(text)
+	}
+
+	query := "It was the best of times, it was the worst of times,"
+	target := SimHash(query)
+	nearest := simstore.FindNearest(query, 10)
+	if len(nearest) != 10 {
+		t.Fatalf("Expected 10 results, got %d", len(nearest))
+	}
+
+	// compare with brute force: nothing outside the results may be closer than the last one
+	for i, m := range nearest {
+		if hamming_distance(keys[m.Id], target) != m.Distance {
+			t.Errorf("Wrong distance for id %d", m.Id)
+		}
+		if i > 0 && nearest[i-1].Distance > m.Distance {
+			t.Error("Results are not sorted by distance")
+		}
+	}
+	worst := nearest[len(nearest)-1].Distance
+	closer := 0
+	for _, key := range keys {
+		if hamming_distance(key, target) < worst {
+			closer++
+		}
+	}
+	if closer >= 10 {
+		t.Errorf("FindNearest missed items: %d items are closer than %d", closer, worst)
+	}
+}
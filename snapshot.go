@@ -0,0 +1,120 @@
+package simhashing
+
+import "bufio"
+import "encoding/binary"
+import "errors"
+import "fmt"
+import "io"
+
+// A snapshot is just all the (key, id) pairs, the tree gets rebuilt on load.
+// Layout (little endian):
+//
+//	"SIMS"           magic
+//	uint32           version
+//	uint64           number of entries
+//	uint8, [n]byte   length and ID of the algorithm the keys were made with (since version 2)
+//	[uint64, int64]  key and id for every entry
+//
+// Version 1 snapshots don't have the algorithm, their keys were all made with DefaultAlgorithm.
+const snapshot_magic = "SIMS"
+const snapshot_version = 2
+
+// Returned when reading something that isn't a snapshot (or a version we don't know)
+var ErrBadSnapshot = errors.New("simhashing: not a valid snapshot")
+
+// Writes a snapshot of the store to w, so it can be loaded again with ReadSimStore
+func (s *SimStore) WriteTo(w io.Writer) (n int64, err error) {
+
+	bw := bufio.NewWriter(w)
+	keys, _ := s.Stats()
+
+	var header [16]byte
+	copy(header[0:4], snapshot_magic)
+	binary.LittleEndian.PutUint32(header[4:8], snapshot_version)
+	binary.LittleEndian.PutUint64(header[8:16], uint64(keys))
+	written, err := bw.Write(header[:])
+	n += int64(written)
+	if err != nil {
+		return
+	}
+
+	id := s.Algorithm().ID
+	if len(id) > 255 {
+		return n, fmt.Errorf("simhashing: algorithm ID %q is too long for a snapshot", id)
+	}
+	written, err = bw.Write(append([]byte{byte(len(id))}, id...))
+	n += int64(written)
+	if err != nil {
+		return
+	}
+
+	var buf [16]byte
+	s.walk(func(item entry) {
+		if err != nil {
+			return
+		}
+		binary.LittleEndian.PutUint64(buf[0:8], item.key)
+		binary.LittleEndian.PutUint64(buf[8:16], uint64(item.id))
+		written, err = bw.Write(buf[:])
+		n += int64(written)
+	})
+	if err != nil {
+		return
+	}
+
+	err = bw.Flush()
+	return
+}
+
+// Reads a snapshot written by WriteTo into a new SimStore
+func ReadSimStore(r io.Reader) (*SimStore, error) {
+
+	br := bufio.NewReader(r)
+
+	var header [16]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrBadSnapshot
+		}
+		return nil, err
+	}
+	version := binary.LittleEndian.Uint32(header[4:8])
+	if string(header[0:4]) != snapshot_magic || version < 1 || version > snapshot_version {
+		return nil, ErrBadSnapshot
+	}
+	count := binary.LittleEndian.Uint64(header[8:16])
+
+	id := DefaultAlgorithm
+	if version >= 2 {
+		length, err := br.ReadByte()
+		if err != nil {
+			return nil, ErrBadSnapshot
+		}
+		buf := make([]byte, length)
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return nil, ErrBadSnapshot
+		}
+		id = string(buf)
+	}
+
+	// keys made with an algorithm we don't have can't be compared with anything we'd hash
+	s, err := NewSimStoreWithAlgorithm(id)
+	if err != nil {
+		return nil, err
+	}
+	var buf [16]byte
+	for i := uint64(0); i < count; i++ {
+		if _, err := io.ReadFull(br, buf[:]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil, fmt.Errorf("simhashing: snapshot truncated after %d of %d entries", i, count)
+			}
+			return nil, err
+		}
+		s.insert(entry{
+			key: binary.LittleEndian.Uint64(buf[0:8]),
+			id:  int64(binary.LittleEndian.Uint64(buf[8:16])),
+		})
+	}
+
+	return s, nil
+}
@@ -0,0 +1,60 @@
+package simhashing
+
+import "testing"
+import "bytes"
+import "fmt"
+import "math/rand"
+
+func TestSnapshotRoundtrip(t *testing.T) {
+
+	simstore := NewSimStore()
+
+	r := rand.New(rand.NewSource(31337))
+	for i := 0; i < 3*1000; i++ {
+		simstore.Insert(fmt.Sprintf("%016x", r.Int63()), int64(i))
+	}
+
+	var buf bytes.Buffer
+	n, err := simstore.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteTo reported %d bytes, wrote %d", n, buf.Len())
+	}
+
+	loaded, err := ReadSimStore(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, _ := simstore.Stats()
+	loaded_keys, _ := loaded.Stats()
+	if keys != loaded_keys {
+		t.Errorf("Loaded store has %d keys, expected %d", loaded_keys, keys)
+	}
+
+	query := fmt.Sprintf("%016x", r.Int63())
+	expected, _, _ := simstore.Find(query, 12)
+	found, _, _ := loaded.Find(query, 12)
+	if !int64array_sameset(expected, found) {
+		t.Errorf("Find on loaded store returned %v, expected %v", found, expected)
+	}
+}
+
+func TestSnapshotBad(t *testing.T) {
+
+	if _, err := ReadSimStore(bytes.NewReader([]byte("nope"))); err != ErrBadSnapshot {
+		t.Errorf("Expected ErrBadSnapshot, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	simstore := NewSimStore()
+	simstore.Insert("hello", 1)
+	simstore.WriteTo(&buf)
+
+	truncated := buf.Bytes()[:buf.Len()-3]
+	if _, err := ReadSimStore(bytes.NewReader(truncated)); err == nil {
+		t.Error("Expected an error for a truncated snapshot")
+	}
+}
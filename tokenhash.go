@@ -0,0 +1,246 @@
+package simhashing
+
+import "encoding/binary"
+import "fmt"
+import "math/bits"
+import "sort"
+import "sync"
+
+// A 64 bit hash for a single token (shingle), the thing SimHash lets every token vote with
+type TokenHash func(token string) uint64
+
+// the registry of token hashes by name
+var (
+	token_hashes_mu sync.RWMutex
+	token_hashes    = map[string]TokenHash{
+		"strong64": Strong64,
+		"basic64":  Basic64,
+		"fnv1a64":  FNV1a64,
+		"xxh64":    XXH64,
+	}
+)
+
+// Registers a token hash under a name, for example a keyed SipHash:
+//
+//	RegisterTokenHash("siphash-prod", NewSipHash(k0, k1))
+//
+// Names can't be registered twice.
+func RegisterTokenHash(name string, h TokenHash) error {
+
+	token_hashes_mu.Lock()
+	defer token_hashes_mu.Unlock()
+
+	if _, exists := token_hashes[name]; exists {
+		return fmt.Errorf("simhashing: token hash %q is already registered", name)
+	}
+	token_hashes[name] = h
+
+	return nil
+}
+
+// Returns the token hash registered under name
+func LookupTokenHash(name string) (h TokenHash, ok bool) {
+
+	token_hashes_mu.RLock()
+	defer token_hashes_mu.RUnlock()
+
+	h, ok = token_hashes[name]
+	return
+}
+
+// Returns the names of all registered token hashes, sorted
+func TokenHashes() []string {
+
+	token_hashes_mu.RLock()
+	defer token_hashes_mu.RUnlock()
+
+	names := make([]string, 0, len(token_hashes))
+	for name := range token_hashes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Same as SimHash, but every shingle votes with h instead of Strong64
+func SimHashWith(src string, h TokenHash) uint64 {
+
+	counts := token_counts(src, h)
+	return simhash_from_counts(&counts)
+}
+
+// +1 for every bit set in hash, -1 for every bit that isn't
+func add_votes(counts *[64]int, hash uint64) {
+
+	for i := uint8(0); i < 64; i++ {
+		if hash&(1<<i) > 0 {
+			counts[i]++
+		} else {
+			counts[i]--
+		}
+	}
+}
+
+// same as add_votes, but every vote counts weight times
+func add_weighted_votes(counts *[64]int, hash uint64, weight int) {
+
+	for i := uint8(0); i < 64; i++ {
+		if hash&(1<<i) > 0 {
+			counts[i] += weight
+		} else {
+			counts[i] -= weight
+		}
+	}
+}
+
+// FNV-1a, 64 bit version (same as hash/fnv, without the allocation)
+// Cheap, but multiplying only carries changes upwards so the low bits mix poorly, and
+// on inputs as short as a shingle some of the middle bits are practically constant.
+// Here mostly to compare against, prefer xxh64 or SipHash.
+func FNV1a64(in string) uint64 {
+
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(in); i++ {
+		h ^= uint64(in[i])
+		h *= 1099511628211
+	}
+
+	return h
+}
+
+const (
+	xxh_p1 uint64 = 11400714785074694791
+	xxh_p2 uint64 = 14029467366897019727
+	xxh_p3 uint64 = 1609587929392839161
+	xxh_p4 uint64 = 9650029242287828579
+	xxh_p5 uint64 = 2870177450012600261
+)
+
+// XXH64 with seed 0, a straight port of the reference implementation
+func XXH64(in string) uint64 {
+	return xxh64([]byte(in), 0)
+}
+
+func xxh_round(acc, input uint64) uint64 {
+	acc += input * xxh_p2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxh_p1
+}
+
+func xxh_merge(acc, val uint64) uint64 {
+	acc ^= xxh_round(0, val)
+	return acc*xxh_p1 + xxh_p4
+}
+
+func xxh64(b []byte, seed uint64) uint64 {
+
+	n := len(b)
+	var h uint64
+
+	if n >= 32 {
+		v1 := seed + xxh_p1 + xxh_p2
+		v2 := seed + xxh_p2
+		v3 := seed
+		v4 := seed - xxh_p1
+		for len(b) >= 32 {
+			v1 = xxh_round(v1, binary.LittleEndian.Uint64(b[0:8]))
+			v2 = xxh_round(v2, binary.LittleEndian.Uint64(b[8:16]))
+			v3 = xxh_round(v3, binary.LittleEndian.Uint64(b[16:24]))
+			v4 = xxh_round(v4, binary.LittleEndian.Uint64(b[24:32]))
+			b = b[32:]
+		}
+		h = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) + bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		h = xxh_merge(h, v1)
+		h = xxh_merge(h, v2)
+		h = xxh_merge(h, v3)
+		h = xxh_merge(h, v4)
+	} else {
+		h = seed + xxh_p5
+	}
+
+	h += uint64(n)
+
+	for ; len(b) >= 8; b = b[8:] {
+		h ^= xxh_round(0, binary.LittleEndian.Uint64(b[:8]))
+		h = bits.RotateLeft64(h, 27)*xxh_p1 + xxh_p4
+	}
+	if len(b) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(b[:4])) * xxh_p1
+		h = bits.RotateLeft64(h, 23)*xxh_p2 + xxh_p3
+		b = b[4:]
+	}
+	for _, c := range b {
+		h ^= uint64(c) * xxh_p5
+		h = bits.RotateLeft64(h, 11) * xxh_p1
+	}
+
+	h ^= h >> 33
+	h *= xxh_p2
+	h ^= h >> 29
+	h *= xxh_p3
+	h ^= h >> 32
+
+	return h
+}
+
+// Returns SipHash-2-4 with the 128 bit key (k0, k1) as a TokenHash.
+// With a secret key nobody can predict the fingerprints, so they can't craft
+// documents that collide with (or dodge) the ones in a store.
+func NewSipHash(k0, k1 uint64) TokenHash {
+	return func(in string) uint64 {
+		return siphash([]byte(in), k0, k1)
+	}
+}
+
+func siphash(b []byte, k0, k1 uint64) uint64 {
+
+	v0 := k0 ^ 0x736f6d6570736575
+	v1 := k1 ^ 0x646f72616e646f6d
+	v2 := k0 ^ 0x6c7967656e657261
+	v3 := k1 ^ 0x7465646279746573
+
+	round := func() {
+		v0 += v1
+		v1 = bits.RotateLeft64(v1, 13)
+		v1 ^= v0
+		v0 = bits.RotateLeft64(v0, 32)
+		v2 += v3
+		v3 = bits.RotateLeft64(v3, 16)
+		v3 ^= v2
+		v0 += v3
+		v3 = bits.RotateLeft64(v3, 21)
+		v3 ^= v0
+		v2 += v1
+		v1 = bits.RotateLeft64(v1, 17)
+		v1 ^= v2
+		v2 = bits.RotateLeft64(v2, 32)
+	}
+
+	n := len(b)
+	for ; len(b) >= 8; b = b[8:] {
+		m := binary.LittleEndian.Uint64(b[:8])
+		v3 ^= m
+		round()
+		round()
+		v0 ^= m
+	}
+
+	// the last block has the remaining bytes and the length in the top byte
+	m := uint64(n) << 56
+	for i, c := range b {
+		m |= uint64(c) << (8 * uint(i))
+	}
+	v3 ^= m
+	round()
+	round()
+	v0 ^= m
+
+	v2 ^= 0xff
+	round()
+	round()
+	round()
+	round()
+
+	return v0 ^ v1 ^ v2 ^ v3
+}
@@ -0,0 +1,201 @@
+package simhashing
+
+import "testing"
+import "math"
+import "math/rand"
+
+// the key 00 01 02 .. 0f from the SipHash paper
+const sip_k0, sip_k1 = 0x0706050403020100, 0x0f0e0d0c0b0a0908
+
+func TestTokenHashVectors(t *testing.T) {
+
+	seq := func(n int) string {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = byte(i)
+		}
+		return string(b)
+	}
+
+	siphash := NewSipHash(sip_k0, sip_k1)
+
+	vectors := []struct {
+		name     string
+		h        TokenHash
+		in       string
+		expected uint64
+	}{
+		{"fnv1a64", FNV1a64, "", 0xcbf29ce484222325},
+		{"fnv1a64", FNV1a64, "a", 0xaf63dc4c8601ec8c},
+		{"fnv1a64", FNV1a64, "foobar", 0x85944171f73967e8},
+		{"xxh64", XXH64, "", 0xef46db3751d8e999},
+		{"xxh64", XXH64, "a", 0xd24ec4f1a98c6e5b},
+		{"xxh64", XXH64, "abc", 0x44bc2cf5ad770999},
+		{"xxh64", XXH64, "Nobody inspects the spammish repetition", 0xfbcea83c8a378bf1},
+		{"siphash", siphash, "", 0x726fdb47dd0e0e31},
+		{"siphash", siphash, seq(8), 0x93f5f5799a932462},
+		{"siphash", siphash, seq(15), 0xa129ca6149be45e5},
+	}
+
+	for _, v := range vectors {
+		if got := v.h(v.in); got != v.expected {
+			t.Errorf("%s(%q) = %016x, expected %016x", v.name, v.in, got, v.expected)
+		}
+	}
+}
+
+func TestTokenHashRegistry(t *testing.T) {
+
+	for _, name := range []string{"strong64", "basic64", "fnv1a64", "xxh64"} {
+		if _, ok := LookupTokenHash(name); !ok {
+			t.Errorf("%s isn't registered", name)
+		}
+	}
+
+	if _, ok := LookupTokenHash("test-siphash"); !ok { // already there with -count > 1
+		if err := RegisterTokenHash("test-siphash", NewSipHash(1, 2)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := RegisterTokenHash("test-siphash", FNV1a64); err == nil {
+		t.Error("Registering the same name twice should fail")
+	}
+	h, ok := LookupTokenHash("test-siphash")
+	if !ok || h("abc") != siphash([]byte("abc"), 1, 2) {
+		t.Error("Looked up the wrong hash")
+	}
+
+	names := TokenHashes()
+	for i := 1; i < len(names); i++ {
+		if names[i-1] >= names[i] {
+			t.Errorf("Names aren't sorted: %v", names)
+		}
+	}
+}
+
+func TestSimHashWith(t *testing.T) {
+
+	text := "It was the best of times, it was the worst of times,"
+	if SimHashWith(text, Strong64) != SimHash(text) {
+		t.Error("SimHashWith(Strong64) should be SimHash")
+	}
+
+	// different keys, different fingerprints
+	a := SimHashWith(text, NewSipHash(1, 2))
+	b := SimHashWith(text, NewSipHash(3, 4))
+	if a == b {
+		t.Errorf("Two keys gave the same fingerprint %016x", a)
+	}
+
+	// still a simhash: a small edit stays close
+	edited := SimHashWith(text+" it was", XXH64)
+	if d := hamming_distance(SimHashWith(text, XXH64), edited); d > 16 {
+		t.Errorf("Small edit moved %d bits", d)
+	}
+}
+
+// Avalanche: flipping any input bit should flip every output bit half the time.
+func TestTokenHashAvalanche(t *testing.T) {
+
+	hashes := map[string]TokenHash{
+		"xxh64":   XXH64,
+		"siphash": NewSipHash(sip_k0, sip_k1),
+	}
+
+	const samples = 2000
+	const tolerance = 0.08 // about 7 standard deviations
+
+	for name, h := range hashes {
+		r := rand.New(rand.NewSource(1234))
+		var flips [64][64]int // [input bit][output bit]
+		in := make([]byte, 8)
+		for n := 0; n < samples; n++ {
+			r.Read(in)
+			base := h(string(in))
+			for i := 0; i < 64; i++ {
+				in[i/8] ^= 1 << uint(i%8)
+				diff := base ^ h(string(in))
+				in[i/8] ^= 1 << uint(i%8)
+				for o := 0; o < 64; o++ {
+					flips[i][o] += int(diff >> uint(o) & 1)
+				}
+			}
+		}
+
+		worst := 0.0
+		for i := range flips {
+			for o := range flips[i] {
+				worst = math.Max(worst, math.Abs(float64(flips[i][o])/samples-0.5))
+			}
+		}
+		if worst > tolerance {
+			t.Errorf("%s: an output bit flips with p off by %.3f from 0.5", name, worst)
+		}
+	}
+}
+
+// FNV-1a doesn't avalanche: the last byte only reaches the output through a multiply,
+// so flipping its top bit never changes the 7 bits below it.
+// Worse for us, on 3 byte shingles a few bits around 36 hardly ever change at all, and
+// those simhash bits end up the same for every text.
+func TestFNV1aWeaknesses(t *testing.T) {
+
+	if (FNV1a64("abc")^FNV1a64("ab\xe3"))&0x7f != 0 {
+		t.Error("Expected FNV-1a to leave the low bits alone")
+	}
+
+	r := rand.New(rand.NewSource(4321))
+	in := make([]byte, shingle_length)
+	r.Read(in)
+	first := FNV1a64(string(in)) >> 36 & 1
+	for n := 0; n < 1000; n++ {
+		r.Read(in)
+		if FNV1a64(string(in))>>36&1 != first {
+			t.Fatal("Expected bit 36 of FNV-1a to be stuck on shingles")
+		}
+	}
+}
+
+// Bit bias: over random shingles every output bit should be set half the time.
+func TestTokenHashBitBias(t *testing.T) {
+
+	hashes := map[string]TokenHash{
+		"strong64": Strong64,
+		"xxh64":    XXH64,
+		"siphash":  NewSipHash(sip_k0, sip_k1),
+	}
+
+	const samples = 20 * 1000
+	const tolerance = 0.03 // about 8 standard deviations
+
+	for name, h := range hashes {
+		r := rand.New(rand.NewSource(4321))
+		var set [64]int
+		in := make([]byte, shingle_length)
+		for n := 0; n < samples; n++ {
+			r.Read(in)
+			hash := h(string(in))
+			for o := 0; o < 64; o++ {
+				set[o] += int(hash >> uint(o) & 1)
+			}
+		}
+		for o, c := range set {
+			p := float64(c) / samples
+			if p < 0.5-tolerance || p > 0.5+tolerance {
+				t.Errorf("%s: bit %d is set %.3f of the time", name, o, p)
+			}
+		}
+	}
+}
+
+func BenchmarkTokenHashes(b *testing.B) {
+
+	for _, name := range []string{"strong64", "fnv1a64", "xxh64"} {
+		h, _ := LookupTokenHash(name)
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				h("abc")
+			}
+		})
+	}
+}
@@ -1,14 +1,10 @@
 package simhashing
 
+import "math/bits"
+
 // Returns the number of bits set in x
 func BitsSet(x uint64) (count int) {
-
-	count = 0
-	for ; x > 0; count++ {
-		x &= x - 1 // clear the least significant bit set
-	}
-
-	return count
+	return bits.OnesCount64(x)
 }
 
 // split in string into tokens of length
@@ -50,12 +46,5 @@ func Tokenize_stride(in string, length int) (tokens []string) {
 func HammingDistance(a uint64, b uint64) int {
 
 	// keep only the bits that are different
-	x := a ^ b
-
-	count := 0
-	for ; x > 0; count++ {
-		x &= x - 1 // clear the least significant bit set
-	}
-
-	return count
+	return bits.OnesCount64(a ^ b)
 }
@@ -0,0 +1,144 @@
+package simhashing
+
+import "context"
+import "encoding/json"
+import "fmt"
+import "io"
+import "strings"
+
+// What to put in an export of the tree
+type ExportOptions struct {
+	MaxDepth int           // levels below the root to include, 0 means all of them
+	Overlay  *QueryOverlay // if set, mark the nodes a find() for this query visits
+}
+
+// A find() to show on top of the tree
+type QueryOverlay struct {
+	Target   uint64 // the hash we're looking for (SimHash(text) for a text)
+	Distance uint8
+}
+
+// A node of the tree as exported by WriteTreeJSON
+type TreeNode struct {
+	Level       int         `json:"level"`
+	Prefix      *int        `json:"prefix"`       // the byte that leads here from the parent, nil for the root
+	Keys        int         `json:"keys"`         // keys in this node (so 0 unless it's a leaf)
+	SubtreeKeys int         `json:"subtree_keys"` // keys in this node and everything below it
+	Visited     bool        `json:"visited"`      // only with an overlay: find() looked at this node
+	Truncated   bool        `json:"truncated"`    // has subtrees that were left out because of MaxDepth
+	Children    []*TreeNode `json:"children,omitempty"`
+}
+
+// builds the TreeNode version of s, following the options
+func (s *SimStore) tree(opts ExportOptions) *TreeNode {
+
+	visited := make(map[*SimStore]bool)
+	if opts.Overlay != nil {
+		q := new_query(context.Background(), Budget{})
+		q.visit = func(node *SimStore) { visited[node] = true }
+		found := make([]int64, 0)
+		s.find_query(opts.Overlay.Target, opts.Overlay.Distance, q, &found)
+	}
+
+	var build func(node *SimStore, prefix *int) *TreeNode
+	build = func(node *SimStore, prefix *int) *TreeNode {
+
+		t := &TreeNode{
+			Level:       int(node.level),
+			Prefix:      prefix,
+			Keys:        len(node.values),
+			SubtreeKeys: node.num_keys,
+			Visited:     visited[node],
+		}
+
+		if len(node.nodes) == 0 {
+			return t
+		}
+		if opts.MaxDepth > 0 && int(node.level-s.level) >= opts.MaxDepth {
+			t.Truncated = true
+			return t
+		}
+
+		for _, p := range node.prefixes() {
+			p := int(p)
+			t.Children = append(t.Children, build(node.nodes[uint8(p)], &p))
+		}
+
+		return t
+	}
+
+	return build(s, nil)
+}
+
+// Writes the tree as a hierarchical JSON document of TreeNodes
+func (s *SimStore) WriteTreeJSON(w io.Writer, opts ExportOptions) error {
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(s.tree(opts))
+}
+
+// Writes the tree as a Graphviz DOT graph (render with something like `dot -Tsvg`).
+// Leaves are boxes, nodes that were cut off by MaxDepth are dashed,
+// and with an overlay the nodes find() visited are filled.
+func (s *SimStore) WriteDOT(w io.Writer, opts ExportOptions) error {
+
+	var b strings.Builder
+	b.WriteString("digraph simstore {\n")
+	b.WriteString("\tnode [fontname=\"monospace\", fontsize=10];\n")
+	if opts.Overlay != nil {
+		fmt.Fprintf(&b, "\tlabel=\"find(%016x, %d)\";\n", opts.Overlay.Target, opts.Overlay.Distance)
+	}
+
+	// nodes are numbered in the order we see them, which is deterministic since children are sorted
+	next := 0
+	var write func(t *TreeNode) int
+	write = func(t *TreeNode) int {
+
+		id := next
+		next++
+
+		label := fmt.Sprintf("level %d", t.Level)
+		if t.Prefix != nil {
+			label = fmt.Sprintf("%02x\\n%s", *t.Prefix, label)
+		}
+		attrs := []string{}
+		if len(t.Children) == 0 && !t.Truncated {
+			label += fmt.Sprintf("\\n%d/%d keys", t.Keys, max_keys_per_node)
+			attrs = append(attrs, "shape=box")
+		} else {
+			label += fmt.Sprintf("\\n%d keys below", t.SubtreeKeys)
+		}
+		styles := []string{}
+		if t.Truncated {
+			styles = append(styles, "dashed")
+		}
+		if t.Visited {
+			styles = append(styles, "filled")
+			attrs = append(attrs, "fillcolor=\"#ffcc66\"")
+		}
+		if len(styles) > 0 {
+			attrs = append(attrs, fmt.Sprintf("style=\"%s\"", strings.Join(styles, ",")))
+		}
+		attrs = append(attrs, fmt.Sprintf("label=\"%s\"", label))
+		fmt.Fprintf(&b, "\tn%d [%s];\n", id, strings.Join(attrs, ", "))
+
+		for _, child := range t.Children {
+			child_id := write(child)
+			edge := ""
+			if child.Visited {
+				edge = " [penwidth=2]"
+			}
+			fmt.Fprintf(&b, "\tn%d -> n%d%s;\n", id, child_id, edge)
+		}
+
+		return id
+	}
+	write(s.tree(opts))
+
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,86 @@
+package simhashing
+
+import "testing"
+import "bytes"
+import "encoding/json"
+import "fmt"
+import "math/rand"
+import "strings"
+
+func visualize_store() *SimStore {
+
+	simstore := NewSimStore()
+	r := rand.New(rand.NewSource(1337))
+	for i := 0; i < 2*1000; i++ {
+		simstore.Insert(fmt.Sprintf("%016x", r.Int63()), int64(i))
+	}
+
+	return simstore
+}
+
+func TestWriteTreeJSON(t *testing.T) {
+
+	simstore := visualize_store()
+	keys, nodes := simstore.Stats()
+
+	var buf bytes.Buffer
+	if err := simstore.WriteTreeJSON(&buf, ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	var root TreeNode
+	if err := json.Unmarshal(buf.Bytes(), &root); err != nil {
+		t.Fatal(err)
+	}
+	if root.SubtreeKeys != keys || len(root.Children) != nodes || root.Prefix != nil {
+		t.Errorf("Unexpected root %+v", root)
+	}
+
+	// keys sharing their lowest byte end up in a level 2 node
+	for i := 0; i < 300; i++ {
+		simstore.InsertHash(uint64(i)<<8, int64(-1-i))
+	}
+	buf.Reset()
+	simstore.WriteTreeJSON(&buf, ExportOptions{MaxDepth: 1})
+	root = TreeNode{}
+	json.Unmarshal(buf.Bytes(), &root)
+	truncated := 0
+	for _, child := range root.Children {
+		if len(child.Children) > 0 {
+			t.Errorf("MaxDepth 1 exported level 2 nodes")
+		}
+		if child.Truncated {
+			truncated++
+		}
+	}
+	if truncated != 1 {
+		t.Errorf("Expected 1 truncated node, got %d", truncated)
+	}
+}
+
+func TestWriteDOTOverlay(t *testing.T) {
+
+	simstore := visualize_store()
+	target := SimHash("It was the best of times")
+
+	var buf bytes.Buffer
+	if err := simstore.WriteDOT(&buf, ExportOptions{Overlay: &QueryOverlay{Target: target, Distance: 0}}); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	if !strings.HasPrefix(out, "digraph simstore {") || !strings.HasSuffix(out, "}\n") {
+		t.Errorf("Doesn't look like DOT: %q", out)
+	}
+
+	// distance 0: the root and at most the one subtree for the target's byte
+	filled := strings.Count(out, "filled")
+	if filled < 1 || filled > 2 {
+		t.Errorf("Expected 1 or 2 visited nodes, got %d", filled)
+	}
+
+	var again bytes.Buffer
+	simstore.WriteDOT(&again, ExportOptions{Overlay: &QueryOverlay{Target: target, Distance: 0}})
+	if again.String() != out {
+		t.Error("DOT output is not deterministic")
+	}
+}